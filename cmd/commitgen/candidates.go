@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joaquinalmora/commitgen/internal/cache"
+	"github.com/joaquinalmora/commitgen/internal/diff"
+	"github.com/joaquinalmora/commitgen/internal/logger"
+	"github.com/joaquinalmora/commitgen/internal/prompt"
+	"github.com/joaquinalmora/commitgen/internal/provider"
+)
+
+type candidate struct {
+	Message  string `json:"message"`
+	Provider string `json:"provider"`
+}
+
+// suggestCandidates asks the provider chain for up to n messages, appends
+// the heuristic suggestion, limited to types, and lets the user pick one.
+// With --json the options are printed as a JSON array and nothing is
+// cached.
+func suggestCandidates(ctx context.Context, chain *provider.Chain, c *cache.Cache, changes *diff.Diff, types []string, n int, useAI, jsonOut, verbose bool) {
+	var options []candidate
+	var latency time.Duration
+
+	if useAI && chain.Configured() {
+		result, err := chain.Candidates(ctx, changes, n)
+		latency = result.Duration()
+		if verbose {
+			reportAttempts(result.Attempts)
+		}
+		if ctx.Err() != nil {
+			fmt.Fprintln(os.Stderr, "Cancelled")
+			os.Exit(130)
+		}
+		if err != nil {
+			logger.Warn("AI generation failed: %v", err)
+		}
+		for _, msg := range result.Candidates {
+			options = append(options, candidate{Message: msg, Provider: result.Provider})
+		}
+	}
+
+	options = appendUnique(options, candidate{Message: prompt.WithTypes(prompt.FromDiff(changes), types), Provider: "heuristics"})
+
+	if jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(options); err != nil {
+			handleError(err)
+		}
+		return
+	}
+
+	chosen := options[0]
+	if isTerminal(os.Stdin) && isTerminal(os.Stderr) && len(options) > 1 {
+		chosen = pickCandidate(os.Stdin, os.Stderr, options)
+	}
+
+	if chosen.Provider == "heuristics" {
+		latency = 0
+	}
+	_ = c.Set(changes.Paths(), changes.Patch, chosen.Message, chosen.Provider, latency) // ignore cache errors
+	fmt.Println(chosen.Message)
+}
+
+// appendUnique adds extra unless an equivalent message is already present.
+func appendUnique(options []candidate, extra candidate) []candidate {
+	msgs := make([]string, 0, len(options)+1)
+	for _, o := range options {
+		msgs = append(msgs, o.Message)
+	}
+	if len(provider.Dedupe(append(msgs, extra.Message))) == len(msgs) {
+		return options
+	}
+	return append(options, extra)
+}
+
+// pickCandidate prints a numbered list and reads the user's choice. Empty
+// input or end of input selects the first option.
+func pickCandidate(in io.Reader, out io.Writer, options []candidate) candidate {
+	for i, o := range options {
+		lines := strings.Split(o.Message, "\n")
+		fmt.Fprintf(out, "%2d) %s  [%s]\n", i+1, lines[0], o.Provider)
+		for _, line := range lines[1:] {
+			fmt.Fprintf(out, "    %s\n", line)
+		}
+	}
+
+	reader := bufio.NewReader(in)
+	for {
+		fmt.Fprintf(out, "Choose a message [1-%d] (default 1): ", len(options))
+		line, err := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" {
+			return options[0]
+		}
+		if n, convErr := strconv.Atoi(line); convErr == nil && n >= 1 && n <= len(options) {
+			return options[n-1]
+		}
+		if err != nil {
+			return options[0]
+		}
+		fmt.Fprintf(out, "Please enter a number between 1 and %d\n", len(options))
+	}
+}
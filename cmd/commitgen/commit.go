@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+
+	"github.com/joaquinalmora/commitgen/internal/cache"
+	"github.com/joaquinalmora/commitgen/internal/config"
+	"github.com/joaquinalmora/commitgen/internal/diff"
+	"github.com/joaquinalmora/commitgen/internal/errors"
+	"github.com/joaquinalmora/commitgen/internal/logger"
+)
+
+// commitChanges generates a message for the staged changes and records them
+// with git commit, exiting with git's status. With --amend the message
+// describes the amended commit as a whole. Once the commit succeeds the
+// cache entry is marked as used so that `cached` stops offering it. With -i
+// the message is reviewed first.
+func commitChanges(args []string) {
+	if !inGitRepo() {
+		handleError(errors.NoGitRepo())
+	}
+
+	verbose := hasFlag(args, "--verbose")
+	useAI := hasFlag(args, "--ai")
+
+	logger.SetVerbose(verbose)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cfg := config.Load()
+
+	src := diff.Source{Amend: hasFlag(args, "--amend")}
+	changes, err := readChanges(cfg, src, false)
+	if err != nil {
+		handleError(errors.GitError("reading "+src.String(), err))
+	}
+	changes, allowAI := redactSecrets(cfg, changes, verbose)
+	if len(changes.Patch) == 0 {
+		if src.Amend {
+			handleError(errors.NoChanges(src.String()))
+		}
+		handleError(errors.NoStagedChanges())
+	}
+
+	cfg, packages := packageConfig(cfg, changes)
+	if len(packages) > 1 {
+		reportPackages(os.Stderr, changes, packages, false)
+	}
+
+	if cfg.AI.Enabled {
+		useAI = true
+	}
+	if !allowAI {
+		useAI = false
+	}
+	if hasFlag(args, "--body") {
+		cfg.AI.Body = true
+	}
+
+	c := cache.New(cfg.CacheOptions())
+	msg, providerName, _ := generateMessage(ctx, cfg, c, changes, useAI, false, verbose)
+	if hasFlag(args, "-i") || hasFlag(args, "--interactive") {
+		msg = reviewMessage(ctx, cfg, c, changes, msg, providerName, allowAI)
+	}
+	msg = strings.TrimSpace(msg)
+	if msg == "" {
+		handleError(fmt.Errorf("no commit message was generated"))
+	}
+
+	if code := gitCommit(msg, commitFlags(args)); code != 0 {
+		os.Exit(code)
+	}
+	_ = c.MarkUsed(changes.Paths(), changes.Patch) // ignore cache errors
+}
+
+// commitFlags picks the arguments that are passed on to git commit:
+// --amend, --signoff, -S or --gpg-sign with an optional key, --no-verify and
+// --edit, with their short forms.
+func commitFlags(args []string) []string {
+	var flags []string
+	for _, a := range args {
+		switch {
+		case a == "--amend", a == "--signoff", a == "-s", a == "--no-verify", a == "-n", a == "--edit", a == "-e":
+		case strings.HasPrefix(a, "-S"), a == "--gpg-sign", strings.HasPrefix(a, "--gpg-sign="):
+		default:
+			continue
+		}
+		flags = append(flags, a)
+	}
+	return flags
+}
+
+// gitCommit runs git commit with msg as the message, attached to the
+// terminal so that --edit opens the user's editor and hooks can prompt, and
+// returns its exit status.
+func gitCommit(msg string, flags []string) int {
+	f, err := os.CreateTemp("", "commitgen-msg-*")
+	if err != nil {
+		handleError(err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(msg + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		handleError(err)
+	}
+
+	cmd := exec.Command("git", append([]string{"commit", "--file=" + f.Name()}, flags...)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode()
+		}
+		handleError(errors.GitError("git commit", err))
+	}
+	return 0
+}
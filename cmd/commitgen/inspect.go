@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joaquinalmora/commitgen/internal/cache"
+	"github.com/joaquinalmora/commitgen/internal/config"
+)
+
+// inspectCache runs the cache subcommands that look at the cache rather
+// than fill it: list, show, stats, export and import.
+func inspectCache(sub string, args []string) {
+	c := cache.New(config.Load().CacheOptions())
+	all := hasFlag(args, "--all")
+
+	switch sub {
+	case "list":
+		list, err := c.List(all)
+		if err != nil {
+			handleError(err)
+		}
+		if len(list) == 0 {
+			fmt.Fprintln(os.Stderr, "No cached messages found")
+			return
+		}
+		printEntries(os.Stdout, list)
+
+	case "show":
+		if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+			handleError(fmt.Errorf("usage: commitgen cache show <key>"))
+		}
+		found, err := c.Find(args[0])
+		if err != nil {
+			handleError(err)
+		}
+		if len(found) == 0 {
+			fmt.Fprintln(os.Stderr, "No cached message with key", args[0])
+			os.Exit(1)
+		}
+		for i, e := range found {
+			if i > 0 {
+				fmt.Println()
+			}
+			printEntry(os.Stdout, e)
+		}
+
+	case "stats":
+		list, err := c.List(true)
+		if err != nil {
+			handleError(err)
+		}
+		stats, err := c.Stats()
+		if err != nil {
+			handleError(err)
+		}
+		printStats(os.Stdout, list, stats)
+
+	case "export":
+		n, err := c.Export(os.Stdout, all)
+		if err != nil {
+			handleError(err)
+		}
+		fmt.Fprintf(os.Stderr, "Exported %d cached messages\n", n)
+
+	case "import":
+		in := io.Reader(os.Stdin)
+		if len(args) > 0 && args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				handleError(err)
+			}
+			defer f.Close()
+			in = f
+		}
+		n, err := c.Import(in)
+		if err != nil {
+			handleError(fmt.Errorf("importing cached messages: %w (%d imported)", err, n))
+		}
+		fmt.Printf("Imported %d cached messages\n", n)
+
+	default:
+		handleError(fmt.Errorf("unknown cache command %q; use list, show, stats, export or import", sub))
+	}
+}
+
+// printEntries lists cached messages, e.g.
+//
+//	3f2a9c1d0b7e4a11  2h ago  openai  /src/app
+//	    feat(cache): add Cache.Delete
+//	    internal/cache/cache.go
+func printEntries(w io.Writer, list []cache.Entry) {
+	for _, e := range list {
+		fmt.Fprintf(w, "%s  %s ago  %s  %s", e.DiffHash, age(e.Timestamp), e.Provider, repoOf(e))
+		if e.Used {
+			fmt.Fprint(w, "  (committed)")
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "    %s\n", subjectOf(e.Message))
+		fmt.Fprintf(w, "    %s\n", summarizeFiles(e.Files, 3))
+	}
+}
+
+func printEntry(w io.Writer, e cache.Entry) {
+	fmt.Fprintln(w, "Key:        ", e.DiffHash)
+	fmt.Fprintln(w, "Repository: ", repoOf(e))
+	fmt.Fprintf(w, "Cached:      %s (%s ago)\n", e.Timestamp.Format("2006-01-02 15:04:05"), age(e.Timestamp))
+	fmt.Fprintln(w, "Provider:   ", e.Provider)
+	if e.Latency > 0 {
+		fmt.Fprintln(w, "Latency:    ", e.Latency.Round(time.Millisecond))
+	}
+	fmt.Fprintln(w, "Committed:  ", e.Used)
+	fmt.Fprintln(w, "Settings:   ", describeSettings(e.Settings))
+	fmt.Fprintln(w, "Files:")
+	for _, f := range e.Files {
+		fmt.Fprintf(w, "  %s\n", f)
+	}
+	fmt.Fprintln(w, "Message:")
+	for _, line := range strings.Split(strings.TrimSpace(e.Message), "\n") {
+		fmt.Fprintf(w, "  %s\n", line)
+	}
+}
+
+func printStats(w io.Writer, list []cache.Entry, stats cache.Stats) {
+	var size int64
+	repos := map[string]bool{}
+	for _, e := range list {
+		size += e.Size
+		repos[e.Repo] = true
+	}
+	fmt.Fprintf(w, "Entries:  %d, %s on disk\n", len(list), formatBytes(size))
+	fmt.Fprintf(w, "Repos:    %d\n", len(repos))
+
+	lookups := stats.Hits + stats.Misses
+	fmt.Fprintf(w, "Hits:     %d\n", stats.Hits)
+	fmt.Fprintf(w, "Misses:   %d\n", stats.Misses)
+	if lookups > 0 {
+		fmt.Fprintf(w, "Hit rate: %.0f%%\n", 100*float64(stats.Hits)/float64(lookups))
+	}
+	if stats.AIHits > 0 {
+		avg := stats.Saved / time.Duration(stats.AIHits)
+		fmt.Fprintf(w, "Saved:    %s of AI latency, %s per AI hit on average\n", stats.Saved.Round(time.Millisecond), avg.Round(time.Millisecond))
+	}
+}
+
+func repoOf(e cache.Entry) string {
+	if e.Repo == "" {
+		return "(no repository)"
+	}
+	return e.Repo
+}
+
+func describeSettings(s cache.Settings) string {
+	parts := []string{fmt.Sprintf("prompt v%d", s.Prompt)}
+	if len(s.Providers) > 0 {
+		parts = append(parts, strings.Join(s.Providers, ", "))
+	}
+	if s.Body {
+		parts = append(parts, "body")
+	}
+	if len(s.Types) > 0 {
+		parts = append(parts, "types "+strings.Join(s.Types, ", "))
+	}
+	if s.Conventions != "" {
+		parts = append(parts, "conventions "+s.Conventions)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// summarizeFiles joins up to limit file names, counting the rest.
+func summarizeFiles(files []string, limit int) string {
+	if len(files) <= limit {
+		return strings.Join(files, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(files[:limit], ", "), len(files)-limit)
+}
+
+// age describes how long ago t was, e.g. "5m" or "3d".
+func age(t time.Time) string {
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n < 1024:
+		return fmt.Sprintf("%d B", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.1f KiB", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1024*1024))
+	}
+}
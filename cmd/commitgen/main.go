@@ -3,20 +3,28 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joaquinalmora/commitgen/internal/cache"
 	"github.com/joaquinalmora/commitgen/internal/config"
 	"github.com/joaquinalmora/commitgen/internal/diff"
 	"github.com/joaquinalmora/commitgen/internal/doctor"
 	"github.com/joaquinalmora/commitgen/internal/errors"
+	"github.com/joaquinalmora/commitgen/internal/goapi"
 	"github.com/joaquinalmora/commitgen/internal/hook"
 	"github.com/joaquinalmora/commitgen/internal/logger"
 	"github.com/joaquinalmora/commitgen/internal/prompt"
 	"github.com/joaquinalmora/commitgen/internal/provider"
+	"github.com/joaquinalmora/commitgen/internal/redact"
+	"github.com/joaquinalmora/commitgen/internal/scope"
 	"github.com/joaquinalmora/commitgen/internal/shell"
 )
 
@@ -47,11 +55,23 @@ type Command struct {
 
 var commands = map[string]Command{
 	"suggest": {
-		Description: "Suggest a commit message based on staged changes [--ai] [--plain] [--verbose]",
+		Description: "Suggest a commit message based on staged changes [--rev C | --range A..B | --worktree | --stdin] [--ai] [--body] [--stream] [--candidates N [--json]] [--propose-split] [-i] [--plain] [--verbose]",
 		Run: func(args []string) {
 			suggest(args)
 		},
 	},
+	"commit": {
+		Description: "Generate a message for the staged changes and run git commit with it [--ai] [--body] [-i] [-e] [--amend] [-s] [-S] [--no-verify] [--verbose]",
+		Run: func(args []string) {
+			commitChanges(args)
+		},
+	},
+	"split": {
+		Description: "Split the staged changes into several commits, each with its own message [--dry-run] [--ai] [--no-verify] [--signoff] [--verbose]",
+		Run: func(args []string) {
+			splitCommits(args)
+		},
+	},
 	"install-hook": {
 		Description: "Install a git commit hook to auto-suggest commit messages",
 		Run: func(args []string) {
@@ -73,17 +93,21 @@ var commands = map[string]Command{
 		},
 	},
 	"cache": {
-		Description: "Generate and cache commit message for current staged changes [--clear]",
+		Description: "Generate and cache commit message for current staged changes [--body] [--clear [--all]] [--prune], or inspect the cache: list [--all] | show <key> | stats | export [--all] | import",
 		Run: func(args []string) {
-			if hasFlag(args, "--clear") {
+			if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+				inspectCache(args[0], args[1:])
+			} else if hasFlag(args, "--clear") {
 				clearCache(args)
+			} else if hasFlag(args, "--prune") {
+				pruneCache(args)
 			} else {
 				generateCache(args)
 			}
 		},
 	},
 	"cached": {
-		Description: "Get the most recent cached commit message",
+		Description: "Print the cached commit message for the staged changes",
 		Run: func(args []string) {
 			getCached(args)
 		},
@@ -163,6 +187,138 @@ func main() {
 	cmd.Run(os.Args[2:])
 }
 
+// changeSource reads --rev, --range, --worktree and --stdin, of which at
+// most one may be given. Without any of them the staged changes are used.
+func changeSource(args []string) (src diff.Source, stdin bool, err error) {
+	given := 0
+	if v, ok := flagValue(args, "--rev"); ok {
+		src.Rev = v
+		given++
+	}
+	if v, ok := flagValue(args, "--range"); ok {
+		src.Range = v
+		given++
+	}
+	if hasFlag(args, "--worktree") {
+		src.Worktree = true
+		given++
+	}
+	if hasFlag(args, "--stdin") {
+		stdin = true
+		given++
+	}
+
+	if given > 1 {
+		return src, stdin, fmt.Errorf("--rev, --range, --worktree and --stdin cannot be combined")
+	}
+	if (src.Rev != "" && strings.HasPrefix(src.Rev, "-")) || (src.Range != "" && strings.HasPrefix(src.Range, "-")) {
+		return src, stdin, errors.ConfigError("revision", src.Rev+src.Range)
+	}
+	return src, stdin, nil
+}
+
+// readChanges reads the diff selected by src, or a patch from standard
+// input, leaving out the hunks of files matched by the built-in excludes,
+// .commitgenignore and diff.exclude unless diff.include brings them back.
+// Changes to exported Go declarations are worked out from both sides of
+// each file, which a patch on stdin does not provide.
+func readChanges(cfg config.Config, src diff.Source, stdin bool) (*diff.Diff, error) {
+	filter, err := diff.LoadFilter(".commitgenignore", cfg.Diff.Exclude, cfg.Diff.Include)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes *diff.Diff
+	if stdin {
+		changes, err = diff.ReadPatch(os.Stdin, cfg.PatchBytes, filter)
+	} else {
+		changes, err = diff.Read(src, cfg.PatchBytes, filter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !stdin {
+		goapi.Analyze(changes, src.ReadFile)
+	}
+	return changes, nil
+}
+
+// packageConfig returns the configuration for changes in a monorepo: when
+// every changed file inside a package with its own commitgen.yaml belongs
+// to the same one, that package's config, otherwise cfg. It also infers
+// the scope of changes from the scopes config, CODEOWNERS and the paths,
+// and returns the packages the changes touch.
+func packageConfig(cfg config.Config, changes *diff.Diff) (config.Config, []config.Package) {
+	packages := config.Packages(changes.Paths())
+	if len(packages) == 1 {
+		cfg = config.LoadFor(packages[0].Dir)
+	}
+	changes.Scope = inferScope(cfg, changes)
+	return cfg, packages
+}
+
+func inferScope(cfg config.Config, changes *diff.Diff) string {
+	return scope.Infer(changes, scope.Options{Rules: cfg.Scopes, Owners: scope.LoadCodeowners()})
+}
+
+// heuristicMessage suggests a message without AI, using only the types the
+// configuration allows.
+func heuristicMessage(cfg config.Config, changes *diff.Diff) string {
+	return prompt.WithTypes(prompt.FromDiff(changes), cfg.Types)
+}
+
+// reportPackages warns that changes span several monorepo packages. With
+// propose set it also suggests one commit per package, each with a
+// heuristic message under that package's config.
+func reportPackages(w io.Writer, changes *diff.Diff, packages []config.Package, propose bool) {
+	dirs := make([]string, len(packages))
+	for i, p := range packages {
+		dirs[i] = p.Dir
+	}
+	fmt.Fprintf(w, "Note: these changes span %d packages (%s); consider one commit per package.\n", len(packages), strings.Join(dirs, ", "))
+	if !propose {
+		return
+	}
+
+	fmt.Fprintln(w, "Proposed split:")
+	for _, p := range packages {
+		cfg := config.LoadFor(p.Dir)
+		part := changes.Select(p.Files)
+		part.Scope = inferScope(cfg, part)
+		fmt.Fprintf(w, "  %s: %s\n", p.Dir, heuristicMessage(cfg, part))
+		for _, f := range p.Files {
+			fmt.Fprintf(w, "    %s\n", f)
+		}
+	}
+}
+
+// redactSecrets replaces anything that looks like a secret in changes
+// before a provider can see it, listing each replacement by file and line
+// with --verbose. The second result is false when ai.secrets is "block" and
+// a secret was found, in which case only heuristics may use the changes.
+func redactSecrets(cfg config.Config, changes *diff.Diff, verbose bool) (*diff.Diff, bool) {
+	switch cfg.AI.Secrets {
+	case "off":
+		return changes, true
+	case "redact", "block":
+	default:
+		handleError(errors.ConfigError("ai.secrets", cfg.AI.Secrets))
+	}
+
+	redacted, findings := redact.Diff(changes)
+	if verbose {
+		for _, f := range findings {
+			fmt.Fprintln(os.Stderr, "redacted", f)
+		}
+	}
+	if len(findings) > 0 && cfg.AI.Secrets == "block" {
+		logger.Warn("Staged changes look like they contain secrets; not sending them to an AI provider")
+		return changes, false
+	}
+	return redacted, true
+}
+
 func inGitRepo() bool {
 	cwd, _ := os.Getwd()
 	_, err := os.Stat(filepath.Join(cwd, ".git"))
@@ -170,7 +326,12 @@ func inGitRepo() bool {
 }
 
 func suggest(args []string) {
-	if !inGitRepo() {
+	src, stdin, err := changeSource(args)
+	if err != nil {
+		handleError(err)
+	}
+	// A patch on stdin can be summarised outside a repository, e.g. in CI
+	if !stdin && !inGitRepo() {
 		handleError(errors.NoGitRepo())
 	}
 
@@ -178,35 +339,74 @@ func suggest(args []string) {
 	verbose := hasFlag(args, "--verbose")
 	useAI := hasFlag(args, "--ai")
 	useCache := hasFlag(args, "--cached")
+	stream := hasFlag(args, "--stream")
+	interactive := hasFlag(args, "-i") || hasFlag(args, "--interactive")
 
 	logger.SetVerbose(verbose)
 
+	// Ctrl-C cancels any in-flight provider request through the context
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	cfg := config.Load()
-	if cfg.AI.Enabled {
-		useAI = true
-	}
 
-	logger.Debug("Configuration loaded: AI enabled=%v, provider=%s", cfg.AI.Enabled, cfg.AI.Provider)
+	source := src.String()
+	if stdin {
+		source = "standard input"
+	}
 
-	files, patch, err := diff.StagedChanges(cfg.PatchBytes)
+	changes, err := readChanges(cfg, src, stdin)
 	if err != nil {
-		handleError(errors.GitError("reading staged changes", err))
+		handleError(errors.GitError("reading "+source, err))
 	}
+	changes, allowAI := redactSecrets(cfg, changes, verbose)
+	files, patch := changes.Paths(), changes.Patch
 
 	if len(patch) == 0 {
 		if plain {
 			return
 		}
-		handleError(errors.NoStagedChanges())
+		if src == (diff.Source{}) && !stdin {
+			handleError(errors.NoStagedChanges())
+		}
+		handleError(errors.NoChanges(source))
+	}
+
+	cfg, packages := packageConfig(cfg, changes)
+	if len(packages) > 1 && !plain {
+		reportPackages(os.Stderr, changes, packages, hasFlag(args, "--propose-split"))
+	}
+
+	if cfg.AI.Enabled {
+		useAI = true
+	}
+	if !allowAI {
+		useAI = false
 	}
+	if hasFlag(args, "--body") {
+		cfg.AI.Body = true
+	}
+
+	logger.Debug("Configuration loaded: AI enabled=%v, provider=%s", cfg.AI.Enabled, cfg.AI.Provider)
 
 	logger.Debug("Found %d changed files, patch size: %d bytes", len(files), len(patch))
 
-	c := cache.New()
+	c := cache.New(cfg.CacheOptions())
+
+	if v, ok := flagValue(args, "--candidates"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			handleError(errors.ConfigError("--candidates", v))
+		}
+		chain := provider.NewChain(cfg.ProviderConfigs())
+		suggestCandidates(ctx, chain, c, changes, cfg.Types, n, useAI, hasFlag(args, "--json"), verbose)
+		return
+	}
 
 	if useCache {
-		cached, err := c.GetLatest()
-		if err == nil {
+		cached, err := c.Get(files, patch)
+		if err == nil && !cached.Used {
+			_ = c.RecordHit(cached) // ignore cache errors
 			if verbose {
 				fmt.Fprintln(os.Stderr, "Using cached message from", cached.Timestamp.Format("15:04:05"))
 			}
@@ -218,78 +418,115 @@ func suggest(args []string) {
 			return
 		}
 		if verbose {
-			fmt.Fprintln(os.Stderr, "No valid cache found, generating new message")
+			if err == nil {
+				err = fmt.Errorf("cached message has been committed")
+			}
+			fmt.Fprintf(os.Stderr, "Not using the cache (%v), generating new message\n", err)
 		}
 	}
 
-	cached, err := c.Get(files, patch)
-	if err == nil && !useCache {
-		logger.Debug("Using cached message for these changes")
-		if plain {
-			fmt.Println(cached.Message)
-		} else {
-			fmt.Println(cached.Message)
+	msg, providerName, fromCache := generateMessage(ctx, cfg, c, changes, useAI, stream, verbose)
+	if interactive {
+		msg, fromCache = reviewMessage(ctx, cfg, c, changes, msg, providerName, allowAI), false
+	}
+	if fromCache {
+		fmt.Println(msg)
+		return
+	}
+
+	if plain {
+		s := strings.TrimSpace(msg)
+		if s != "" {
+			fmt.Println(s)
 		}
 		return
 	}
 
-	var msg string
+	if verbose {
+		// With ai.secrets: block, changes still holds the secrets for the
+		// heuristics, so only ever print a redacted copy
+		shown, _ := redact.Diff(changes)
+		fmt.Fprintln(os.Stderr, len(patch), "bytes of staged changes")
+		fmt.Fprintln(os.Stderr, shown.Patch[:min(100, len(shown.Patch))])
+		fmt.Fprintln(os.Stderr, msg)
+		return
+	}
 
-	if useAI && cfg.AI.APIKey != "" {
-		logger.Info("Using AI provider: %s", cfg.AI.Provider)
+	fmt.Println(msg)
+}
 
-		providerConfig := provider.Config{
-			Provider: cfg.AI.Provider,
-			APIKey:   cfg.AI.APIKey,
-			Model:    cfg.AI.Model,
-			BaseURL:  cfg.AI.BaseURL,
+// generateMessage returns a message for changes: the cached one for the
+// same changes if it has the right shape, otherwise one from the provider
+// chain when useAI is set and a provider is configured, falling back to
+// heuristics. New messages are cached when AI was asked for. It also
+// returns the backend that wrote the message and whether it was a cache
+// hit.
+func generateMessage(ctx context.Context, cfg config.Config, c *cache.Cache, changes *diff.Diff, useAI, stream, verbose bool) (msg, providerName string, fromCache bool) {
+	files, patch := changes.Paths(), changes.Patch
+
+	cached, err := c.Get(files, patch)
+	if err == nil {
+		logger.Debug("Using cached message for these changes")
+		_ = c.RecordHit(cached) // ignore cache errors
+		return cached.Message, cached.Provider, true
+	}
+	logger.Debug("Not using the cache: %v", err)
+
+	providerName = "heuristics"
+	chain := provider.NewChain(cfg.ProviderConfigs())
+
+	if useAI && chain.Configured() {
+		// Wait for a generation for the same changes that is already
+		// running, such as the post-index-change hook's, and use its
+		// result. Lock stops waiting after a while, and then this
+		// generates on its own.
+		if unlock, err := c.Lock(ctx, files, patch); err == nil {
+			defer unlock()
+			if cached, err := c.Get(files, patch); err == nil {
+				logger.Debug("Using the message another commitgen process generated for these changes")
+				_ = c.RecordHit(cached) // ignore cache errors
+				return cached.Message, cached.Provider, true
+			}
 		}
+		_ = c.RecordMiss() // ignore cache errors
+
+		logger.Info("Using AI providers: %s", strings.Join(chain.Names(), ", "))
 
-		aiProvider, err := provider.GetProvider(providerConfig)
+		logger.Debug("Sending request to AI provider...")
+		var result provider.Result
+		if stream {
+			result, err = streamMessage(ctx, chain, changes)
+		} else {
+			result, err = chain.Generate(ctx, changes)
+		}
+		if verbose {
+			reportAttempts(result.Attempts)
+		}
+		if ctx.Err() != nil {
+			fmt.Fprintln(os.Stderr, "Cancelled")
+			os.Exit(130)
+		}
 		if err != nil {
-			logger.Warn("AI provider initialization failed: %v", err)
+			logger.Warn("AI generation failed: %v", err)
 			logger.Info("Falling back to heuristic message generation")
-			msg = prompt.MakePrompt(files, patch)
+			msg = heuristicMessage(cfg, changes)
 		} else {
-			ctx := context.Background()
-			logger.Debug("Sending request to AI provider...")
-			aiMsg, err := aiProvider.GenerateCommitMessage(ctx, files, patch)
-			if err != nil {
-				logger.Warn("AI generation failed: %v", err)
-				logger.Info("Falling back to heuristic message generation")
-				msg = prompt.MakePrompt(files, patch)
-			} else {
-				msg = aiMsg
-				logger.Debug("Successfully generated commit message using AI")
-				_ = c.Set(files, patch, msg, cfg.AI.Provider) // ignore cache errors
-			}
+			msg, providerName = result.Message, result.Provider
+			logger.Debug("Successfully generated commit message using %s", result.Provider)
+			_ = c.Set(files, patch, msg, result.Provider, result.Duration()) // ignore cache errors
 		}
 	} else {
+		_ = c.RecordMiss() // ignore cache errors
 		if useAI && verbose {
 			fmt.Fprintln(os.Stderr, "AI requested but no API key configured, using heuristics")
 		}
-		msg = prompt.MakePrompt(files, patch)
+		msg = heuristicMessage(cfg, changes)
 		if useAI {
-			_ = c.Set(files, patch, msg, "heuristics") // ignore cache errors
+			_ = c.Set(files, patch, msg, "heuristics", 0) // ignore cache errors
 		}
 	}
 
-	if plain {
-		s := strings.TrimSpace(msg)
-		if s != "" {
-			fmt.Println(s)
-		}
-		return
-	}
-
-	if verbose {
-		fmt.Fprintln(os.Stderr, len(patch), "bytes of staged changes")
-		fmt.Fprintln(os.Stderr, patch[:min(100, len(patch))])
-		fmt.Fprintln(os.Stderr, msg)
-		return
-	}
-
-	fmt.Println(msg)
+	return msg, providerName, false
 }
 
 func generateCache(args []string) {
@@ -301,11 +538,13 @@ func generateCache(args []string) {
 	verbose := hasFlag(args, "--verbose")
 	cfg := config.Load()
 
-	files, patch, err := diff.StagedChanges(cfg.PatchBytes)
+	changes, err := readChanges(cfg, diff.Source{}, false)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error:", err)
 		os.Exit(1)
 	}
+	changes, allowAI := redactSecrets(cfg, changes, verbose)
+	files, patch := changes.Paths(), changes.Patch
 
 	if len(patch) == 0 {
 		if verbose {
@@ -314,50 +553,66 @@ func generateCache(args []string) {
 		return
 	}
 
-	c := cache.New()
+	cfg, _ = packageConfig(cfg, changes)
+	if hasFlag(args, "--body") {
+		cfg.AI.Body = true
+	}
+
+	c := cache.New(cfg.CacheOptions())
+	chain := provider.NewChain(cfg.ProviderConfigs())
+	useAI := allowAI && chain.Configured()
+
+	// Overlapping git add calls start several of these; only one generates
+	// and the others find its result once they get the lock
+	unlock, err := c.Lock(context.Background(), files, patch)
+	if err != nil {
+		if verbose {
+			fmt.Fprintln(os.Stderr, "Cache lock error:", err)
+		}
+		return
+	}
+	defer unlock()
+	cached, err := c.Get(files, patch)
+	if err == nil && !(useAI && cached.Provider == "heuristics") {
+		if verbose {
+			fmt.Fprintln(os.Stderr, "Already cached using", cached.Provider+":", cached.Message)
+		}
+		return
+	}
+	if verbose && err != nil {
+		fmt.Fprintln(os.Stderr, "Not using the cache:", err)
+	}
 
 	var msg string
 	var providerName string
+	var latency time.Duration
 
-	if cfg.AI.APIKey != "" {
+	if useAI {
 		if verbose {
 			fmt.Fprintln(os.Stderr, "Generating AI cache for", len(files), "files")
 		}
 
-		providerConfig := provider.Config{
-			Provider: cfg.AI.Provider,
-			APIKey:   cfg.AI.APIKey,
-			Model:    cfg.AI.Model,
-			BaseURL:  cfg.AI.BaseURL,
+		result, err := chain.Generate(context.Background(), changes)
+		if verbose {
+			reportAttempts(result.Attempts)
 		}
-
-		aiProvider, err := provider.GetProvider(providerConfig)
 		if err != nil {
 			if verbose {
-				fmt.Fprintln(os.Stderr, "AI provider error:", err)
+				fmt.Fprintln(os.Stderr, "AI generation error:", err)
 			}
-			msg = prompt.MakePrompt(files, patch)
+			msg = heuristicMessage(cfg, changes)
 			providerName = "heuristics"
 		} else {
-			ctx := context.Background()
-			aiMsg, err := aiProvider.GenerateCommitMessage(ctx, files, patch)
-			if err != nil {
-				if verbose {
-					fmt.Fprintln(os.Stderr, "AI generation error:", err)
-				}
-				msg = prompt.MakePrompt(files, patch)
-				providerName = "heuristics"
-			} else {
-				msg = aiMsg
-				providerName = cfg.AI.Provider
-			}
+			msg = result.Message
+			providerName = result.Provider
+			latency = result.Duration()
 		}
 	} else {
-		msg = prompt.MakePrompt(files, patch)
+		msg = heuristicMessage(cfg, changes)
 		providerName = "heuristics"
 	}
 
-	err = c.Set(files, patch, msg, providerName)
+	err = c.Set(files, patch, msg, providerName, latency)
 	if err != nil {
 		if verbose {
 			fmt.Fprintln(os.Stderr, "Cache save error:", err)
@@ -370,19 +625,149 @@ func generateCache(args []string) {
 	}
 }
 
+// streamMessage shows the message while it is generated. On a terminal the
+// raw tokens go to stdout and are erased once the final, cleaned-up message
+// is ready to be printed in their place; otherwise they go to stderr so that
+// stdout only ever carries the final message.
+func streamMessage(ctx context.Context, chain *provider.Chain, changes *diff.Diff) (provider.Result, error) {
+	tty := isTerminal(os.Stdout)
+
+	out := &streamWriter{w: os.Stderr}
+	if tty {
+		out.w = os.Stdout
+		out.width = terminalWidth(os.Stdout)
+	}
+
+	result, err := chain.Stream(ctx, changes, out)
+
+	switch {
+	case out.written == 0:
+	case tty:
+		// Return to the first streamed line and clear to the end of screen
+		fmt.Fprint(os.Stdout, "\r")
+		if out.lines > 0 {
+			fmt.Fprintf(os.Stdout, "\033[%dA", out.lines)
+		}
+		fmt.Fprint(os.Stdout, "\033[J")
+	default:
+		fmt.Fprintln(os.Stderr)
+	}
+
+	return result, err
+}
+
+// streamWriter tracks how much streamed output has been written so that it
+// can be cleared again. Lines longer than width, when it is known, count as
+// the several screen lines the terminal wraps them into.
+type streamWriter struct {
+	w       io.Writer
+	width   int
+	written int
+	lines   int
+	column  int
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.written += n
+	for _, b := range p[:n] {
+		switch {
+		case b == '\n':
+			s.lines++
+			s.column = 0
+		case b == '\r':
+			s.column = 0
+		case b&0xC0 == 0x80:
+			// UTF-8 continuation bytes share their character's column
+		default:
+			if s.width > 0 && s.column == s.width {
+				s.lines++
+				s.column = 0
+			}
+			s.column++
+		}
+	}
+	return n, err
+}
+
+// terminalWidth returns the number of columns of the terminal on f, or 0
+// when stty cannot tell.
+func terminalWidth(f *os.File) int {
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = f
+	out, err := cmd.Output()
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return 0
+	}
+	cols, _ := strconv.Atoi(fields[1])
+	return cols
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// reportAttempts prints which backends of the provider chain were tried and
+// why each one that failed did so.
+func reportAttempts(attempts []provider.Attempt) {
+	for _, a := range attempts {
+		tries := ""
+		if a.Tries > 1 {
+			tries = fmt.Sprintf(", %d tries", a.Tries)
+		}
+		if a.Err == nil {
+			fmt.Fprintf(os.Stderr, "provider %s: ok in %s%s\n", a.Provider, a.Duration.Round(time.Millisecond), tries)
+			continue
+		}
+		reason := strings.SplitN(a.Err.Error(), "\n", 2)[0]
+		fmt.Fprintf(os.Stderr, "provider %s: failed after %s%s: %s\n", a.Provider, a.Duration.Round(time.Millisecond), tries, reason)
+	}
+}
+
+// getCached prints the message cached for the staged changes, unless it
+// has been committed already.
 func getCached(args []string) {
 	plain := hasFlag(args, "--plain")
 	verbose := hasFlag(args, "--verbose")
 
-	c := cache.New()
-	cached, err := c.GetLatest()
+	cfg := config.Load()
+	changes, err := readChanges(cfg, diff.Source{}, false)
+	if err != nil {
+		if !plain {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+		os.Exit(1)
+	}
+	changes, _ = redactSecrets(cfg, changes, false)
+	// The settings must match those the message was cached with
+	cfg, _ = packageConfig(cfg, changes)
+
+	c := cache.New(cfg.CacheOptions())
+	cached, err := c.Get(changes.Paths(), changes.Patch)
+	if err == nil && cached.Used {
+		err = fmt.Errorf("cached message has been committed")
+	}
 	if err != nil {
+		_ = c.RecordMiss() // ignore cache errors
 		if !plain {
 			fmt.Fprintln(os.Stderr, "No cached messages found")
+			if verbose {
+				fmt.Fprintln(os.Stderr, "Reason:", err)
+			}
 		}
 		os.Exit(1)
 	}
 
+	_ = c.RecordHit(cached) // ignore cache errors
+
 	if verbose && !plain {
 		fmt.Fprintln(os.Stderr, "Cached at:", cached.Timestamp.Format("2006-01-02 15:04:05"))
 		fmt.Fprintln(os.Stderr, "Provider:", cached.Provider)
@@ -395,9 +780,12 @@ func getCached(args []string) {
 func clearCache(args []string) {
 	verbose := hasFlag(args, "--verbose")
 
-	c := cache.New()
-	err := c.Clear()
-	if err != nil {
+	c := cache.New(cache.Options{})
+	remove := c.Clear
+	if hasFlag(args, "--all") {
+		remove = c.ClearAll
+	}
+	if err := remove(); err != nil {
 		fmt.Fprintln(os.Stderr, "Error clearing cache:", err)
 		os.Exit(1)
 	}
@@ -409,6 +797,24 @@ func clearCache(args []string) {
 	}
 }
 
+// pruneCache removes expired messages and evicts the least recently used
+// ones past the configured limits.
+func pruneCache(args []string) {
+	verbose := hasFlag(args, "--verbose")
+
+	c := cache.New(config.Load().CacheOptions())
+	result, err := c.Prune()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error pruning cache:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Removed %d expired and %d evicted messages\n", result.Expired, result.Evicted)
+	if verbose {
+		fmt.Fprintf(os.Stderr, "%d messages left, %d bytes\n", result.Remaining, result.Bytes)
+	}
+}
+
 func hasFlag(args []string, flag string) bool {
 	for _, a := range args {
 		if a == flag {
@@ -418,6 +824,20 @@ func hasFlag(args []string, flag string) bool {
 	return false
 }
 
+// flagValue returns the value of a flag given as "--name value" or
+// "--name=value".
+func flagValue(args []string, flag string) (string, bool) {
+	for i, a := range args {
+		if a == flag && i+1 < len(args) {
+			return args[i+1], true
+		}
+		if v, ok := strings.CutPrefix(a, flag+"="); ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -457,15 +877,32 @@ func initConfig(args []string) {
 		}
 	}
 
-	fmt.Print("Enter your OpenAI API key (or press Enter to configure later): ")
+	names := provider.Names()
+	fmt.Printf("Choose AI provider [%s] (default: openai): ", strings.Join(names, "/"))
+	var providerName string
+	_, _ = fmt.Scanln(&providerName) // ignore input errors
+	providerName = strings.ToLower(providerName)
+	if providerName == "" {
+		providerName = "openai"
+	}
+	factory, ok := provider.Lookup(providerName)
+	if !ok {
+		fmt.Printf("Unknown provider %q, using openai\n", providerName)
+		providerName = "openai"
+		factory, _ = provider.Lookup(providerName)
+	}
+
 	var apiKey string
-	_, _ = fmt.Scanln(&apiKey) // ignore input errors
+	if factory.RequiresKey {
+		fmt.Printf("Enter your %s API key (or press Enter to configure later): ", factory.DisplayName)
+		_, _ = fmt.Scanln(&apiKey) // ignore input errors
+	}
 
-	fmt.Print("Choose AI model [gpt-4o/gpt-4o-mini/gpt-3.5-turbo] (default: gpt-4o-mini): ")
+	fmt.Printf("Choose AI model (default: %s): ", factory.DefaultModel)
 	var model string
 	_, _ = fmt.Scanln(&model) // ignore input errors
 	if model == "" {
-		model = "gpt-4o-mini"
+		model = factory.DefaultModel
 	}
 
 	fmt.Print("Enable AI by default? [y/N]: ")
@@ -478,7 +915,7 @@ func initConfig(args []string) {
 
 ai:
   enabled: %t
-  provider: "openai"
+  provider: "%s"
   model: "%s"
   api_key: "%s"
   base_url: ""
@@ -501,7 +938,7 @@ advanced:
   conventions_file: ""
   fallback_enabled: true
   debug: false
-`, aiEnabled, model, apiKey)
+`, aiEnabled, providerName, model, apiKey)
 
 	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
 		fmt.Printf("Failed to create config file: %v\n", err)
@@ -511,8 +948,8 @@ advanced:
 	fmt.Printf("Configuration file created at %s\n", configPath)
 	fmt.Println()
 	fmt.Println("Next steps:")
-	if apiKey == "" {
-		fmt.Println("1. Add your OpenAI API key to the config file or set OPENAI_API_KEY environment variable")
+	if factory.RequiresKey && apiKey == "" {
+		fmt.Printf("1. Add your %s API key to the config file or set %s environment variable\n", factory.DisplayName, factory.APIKeyEnv)
 	}
 	fmt.Println("2. Customize the configuration as needed")
 	fmt.Println("3. Run 'commitgen suggest' to test your setup")
@@ -524,16 +961,33 @@ func generateEnvExample(args []string) {
 		filename = args[0]
 	}
 
-	content := `# commitgen Environment Configuration
+	var b strings.Builder
+	b.WriteString(`# commitgen Environment Configuration
 # Copy this file to .env and add your actual API keys
 
-# OpenAI Configuration (Primary AI Provider)
-# Get your API key from: https://platform.openai.com/api-keys
-OPENAI_API_KEY=your-openai-api-key-here
+# Provider selection (one of: ` + strings.Join(provider.Names(), ", ") + `)
+# COMMITGEN_PROVIDER=openai
+`)
 
-# Optional: Override default model (gpt-4o-mini)
+	for _, f := range provider.Registered() {
+		fmt.Fprintf(&b, "\n# %s (default model %s)\n", f.DisplayName, f.DefaultModel)
+		if f.APIKeyEnv != "" {
+			fmt.Fprintf(&b, "%s=your-%s-api-key-here\n", f.APIKeyEnv, f.Name)
+		} else {
+			fmt.Fprintf(&b, "# No API key needed; set COMMITGEN_BASE_URL if not at %s\n", f.DefaultBaseURL)
+		}
+	}
+
+	b.WriteString(`
+# Optional: Override the provider's default model
 # COMMITGEN_MODEL=gpt-4o
 
+# Optional: Generate a body and footers, not just a subject line
+# COMMITGEN_BODY=false
+
+# Optional: What to do with secrets found in the diff: redact, block or off
+# COMMITGEN_SECRETS=redact
+
 # Performance Tuning (optional)
 # COMMITGEN_CACHE_TTL=24h
 # COMMITGEN_MAX_FILES=10
@@ -542,9 +996,9 @@ OPENAI_API_KEY=your-openai-api-key-here
 # Advanced Options (optional)
 # COMMITGEN_AI_FALLBACK=true
 # COMMITGEN_CONVENTIONS_FILE=/path/to/custom-conventions.md
-`
+`)
 
-	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+	if err := os.WriteFile(filename, []byte(b.String()), 0644); err != nil {
 		fmt.Printf("Failed to create %s: %v\n", filename, err)
 		os.Exit(1)
 	}
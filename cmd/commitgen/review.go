@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/joaquinalmora/commitgen/internal/cache"
+	"github.com/joaquinalmora/commitgen/internal/config"
+	"github.com/joaquinalmora/commitgen/internal/diff"
+	"github.com/joaquinalmora/commitgen/internal/message"
+	"github.com/joaquinalmora/commitgen/internal/provider"
+	"github.com/joaquinalmora/commitgen/internal/tui"
+)
+
+// reviewMessage lets the user review msg on the interactive screen: with
+// single keys when stdin and stdout are a terminal, and as plain prompts on
+// stderr otherwise. The accepted message is cached for changes and
+// returned; cancelling exits. Unless allowAI is set, only heuristics can
+// regenerate the message.
+func reviewMessage(ctx context.Context, cfg config.Config, c *cache.Cache, changes *diff.Diff, msg, providerName string, allowAI bool) string {
+	types := cfg.Types
+	if len(types) == 0 {
+		types = message.Types
+	}
+
+	screen := &tui.Screen{
+		Files:    changes.Files,
+		Message:  msg,
+		Provider: providerName,
+		Request:  tui.Request{Provider: cfg.AI.Provider, Model: cfg.AI.Model, Body: cfg.AI.Body},
+		Types:    types,
+		Scopes:   scopeChoices(cfg, changes),
+		In:       os.Stdin,
+		Out:      os.Stderr,
+	}
+	if allowAI {
+		screen.Providers = configuredProviders(cfg)
+	} else {
+		screen.Request.Provider = "heuristics"
+		screen.Providers = []string{"heuristics"}
+	}
+	screen.Generate = func(ctx context.Context, req tui.Request) (string, string, error) {
+		return regenerate(ctx, cfg, changes, req)
+	}
+
+	restore := func() {}
+	editorOut := os.Stderr
+	if isTerminal(os.Stdin) && isTerminal(os.Stdout) {
+		if undo, err := tui.Cbreak(os.Stdin); err == nil {
+			restore = undo
+			screen.Keys = true
+			screen.Out = os.Stdout
+			editorOut = os.Stdout
+		}
+	}
+	screen.Editor = func(text string) (string, error) {
+		if screen.Keys {
+			// The editor gets the terminal as the user normally has it
+			restore()
+			defer func() {
+				if undo, err := tui.Cbreak(os.Stdin); err == nil {
+					restore = undo
+				}
+			}()
+		}
+		return editInEditor(text, editorOut)
+	}
+	ok, err := screen.Run(ctx)
+	restore()
+
+	switch {
+	case ctx.Err() != nil:
+		fmt.Fprintln(os.Stderr, "Cancelled")
+		os.Exit(130)
+	case err != nil:
+		handleError(err)
+	case !ok:
+		fmt.Fprintln(os.Stderr, "Review cancelled")
+		os.Exit(1)
+	}
+
+	_ = c.Set(changes.Paths(), changes.Patch, screen.Message, screen.Provider, 0) // ignore cache errors
+	return screen.Message
+}
+
+// editInEditor opens text in the editor git would use for a commit message,
+// with out as its terminal output, and returns the saved text.
+func editInEditor(text string, out *os.File) (string, error) {
+	editor, err := exec.Command("git", "var", "GIT_EDITOR").Output()
+	if err != nil {
+		return "", fmt.Errorf("finding an editor: %w", err)
+	}
+
+	f, err := os.CreateTemp("", "commitgen-msg-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(text + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Like git, run the editor through the shell so that it may carry
+	// arguments, e.g. "code --wait"
+	cmd := exec.Command("sh", "-c", strings.TrimSpace(string(editor))+` "$@"`, "editor", f.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, out, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running the editor: %w", err)
+	}
+	data, err := os.ReadFile(f.Name())
+	return string(data), err
+}
+
+// regenerate writes a new message with the provider, model and body mode
+// chosen on the review screen. The configured chain is used as long as the
+// provider and model are the configured ones.
+func regenerate(ctx context.Context, cfg config.Config, changes *diff.Diff, req tui.Request) (string, string, error) {
+	cfg.AI.Body = req.Body
+	if req.Provider == "heuristics" {
+		return heuristicMessage(cfg, changes), "heuristics", nil
+	}
+
+	if req.Provider != cfg.AI.Provider || req.Model != cfg.AI.Model {
+		if req.Provider != cfg.AI.Provider {
+			// The key and base URL belong to the configured provider
+			cfg.AI.APIKey, cfg.AI.BaseURL = "", ""
+		}
+		cfg.AI.Providers = nil
+		cfg.AI.Provider, cfg.AI.Model = req.Provider, req.Model
+	}
+
+	chain := provider.NewChain(cfg.ProviderConfigs())
+	if !chain.Configured() {
+		return "", "", fmt.Errorf("%s has no API key configured", req.Provider)
+	}
+	result, err := chain.Generate(ctx, changes)
+	return result.Message, result.Provider, err
+}
+
+// configuredProviders lists the registered providers that have the
+// credentials they need, followed by heuristics.
+func configuredProviders(cfg config.Config) []string {
+	var names []string
+	for _, name := range provider.Names() {
+		single := cfg
+		single.AI.Providers = nil
+		if name != cfg.AI.Provider {
+			single.AI.Provider, single.AI.Model, single.AI.APIKey, single.AI.BaseURL = name, "", "", ""
+		}
+		if provider.NewChain(single.ProviderConfigs()).Configured() {
+			names = append(names, name)
+		}
+	}
+	return append(names, "heuristics")
+}
+
+// scopeChoices lists the scopes the review screen offers: the inferred one,
+// those of the individual files and the configured ones.
+func scopeChoices(cfg config.Config, changes *diff.Diff) []string {
+	var scopes []string
+	add := func(s string) {
+		if s != "" && !containsString(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+
+	add(changes.Scope)
+	for _, f := range changes.Files {
+		add(inferScope(cfg, changes.Select([]string{f.Path})))
+	}
+	var configured []string
+	for _, s := range cfg.Scopes {
+		configured = append(configured, s)
+	}
+	sort.Strings(configured)
+	for _, s := range configured {
+		add(s)
+	}
+	return scopes
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
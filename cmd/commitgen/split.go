@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/joaquinalmora/commitgen/internal/config"
+	"github.com/joaquinalmora/commitgen/internal/diff"
+	"github.com/joaquinalmora/commitgen/internal/errors"
+	"github.com/joaquinalmora/commitgen/internal/logger"
+	"github.com/joaquinalmora/commitgen/internal/provider"
+	"github.com/joaquinalmora/commitgen/internal/scope"
+	"github.com/joaquinalmora/commitgen/internal/split"
+)
+
+// splitCommits groups the staged changes into several commits, each with
+// its own message, and creates them one at a time. With --dry-run, or when
+// everything belongs in one commit, it only prints the plan.
+func splitCommits(args []string) {
+	if !inGitRepo() {
+		handleError(errors.NoGitRepo())
+	}
+
+	dryRun := hasFlag(args, "--dry-run")
+	verbose := hasFlag(args, "--verbose")
+	useAI := hasFlag(args, "--ai")
+
+	logger.SetVerbose(verbose)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cfg := config.Load()
+	if cfg.AI.Enabled {
+		useAI = true
+	}
+
+	changes, err := readChanges(cfg, diff.Source{}, false)
+	if err != nil {
+		handleError(errors.GitError("reading staged changes", err))
+	}
+	if len(changes.Patch) == 0 {
+		handleError(errors.NoStagedChanges())
+	}
+	redacted, allowAI := redactSecrets(cfg, changes, verbose)
+	if !allowAI {
+		useAI = false
+	}
+
+	var dirs []string
+	for _, p := range config.Packages(changes.Paths()) {
+		dirs = append(dirs, p.Dir)
+	}
+	commits := split.Plan(changes, split.Options{
+		Scopes:   scope.Options{Rules: cfg.Scopes, Owners: scope.LoadCodeowners()},
+		Packages: dirs,
+	})
+
+	for i := range commits {
+		part := redacted.Select(commits[i].Files)
+		partCfg, _ := packageConfig(cfg, part)
+		commits[i].Message, commits[i].Provider = splitMessage(ctx, partCfg, part, useAI, verbose)
+	}
+
+	if dryRun || len(commits) == 1 {
+		if !dryRun {
+			fmt.Fprintln(os.Stderr, "The staged changes belong in one commit; nothing to split.")
+		}
+		printPlan(os.Stdout, commits, verbose)
+		return
+	}
+
+	var flags []string
+	for _, f := range []string{"--no-verify", "--signoff"} {
+		if hasFlag(args, f) {
+			flags = append(flags, f)
+		}
+	}
+
+	created, err := split.Apply(changes, commits, flags, func(c split.Commit, hash string) {
+		fmt.Printf("[%s] %s\n", hash, subjectOf(c.Message))
+	})
+	if err != nil {
+		handleError(errors.SplitFailed(created, len(commits), err))
+	}
+}
+
+// splitMessage writes the message for one group of a split, falling back
+// to heuristics when AI is off or fails.
+func splitMessage(ctx context.Context, cfg config.Config, part *diff.Diff, useAI, verbose bool) (msg, providerName string) {
+	chain := provider.NewChain(cfg.ProviderConfigs())
+	if useAI && chain.Configured() {
+		result, err := chain.Generate(ctx, part)
+		if verbose {
+			reportAttempts(result.Attempts)
+		}
+		if ctx.Err() != nil {
+			fmt.Fprintln(os.Stderr, "Cancelled")
+			os.Exit(130)
+		}
+		if err == nil {
+			return result.Message, result.Provider
+		}
+		logger.Warn("AI generation failed: %v", err)
+	}
+	return heuristicMessage(cfg, part), "heuristics"
+}
+
+// printPlan lists the proposed commits with their files, e.g.
+//
+//  1. feat(cache): add Cache.Delete
+//     internal/cache/cache.go
+func printPlan(w io.Writer, commits []split.Commit, verbose bool) {
+	for i, c := range commits {
+		fmt.Fprintf(w, "%d. %s", i+1, subjectOf(c.Message))
+		if verbose {
+			fmt.Fprintf(w, " (%s)", c.Provider)
+		}
+		fmt.Fprintln(w)
+		for _, f := range c.Files {
+			fmt.Fprintf(w, "   %s\n", f)
+		}
+	}
+}
+
+// subjectOf returns the first line of a commit message.
+func subjectOf(msg string) string {
+	subject, _, _ := strings.Cut(strings.TrimSpace(msg), "\n")
+	return subject
+}
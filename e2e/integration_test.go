@@ -10,7 +10,9 @@ import (
 	"testing"
 )
 
-func TestSuggestPlainIntegration(t *testing.T) {
+// buildBinary builds commitgen into a temporary directory.
+func buildBinary(t *testing.T) string {
+	t.Helper()
 	wd, err := os.Getwd()
 	if err != nil {
 		t.Fatal(err)
@@ -38,8 +40,13 @@ func TestSuggestPlainIntegration(t *testing.T) {
 	if out, err := build.CombinedOutput(); err != nil {
 		t.Fatalf("build failed: %v\n%s", err, string(out))
 	}
+	return binPath
+}
 
-	repo := filepath.Join(tmp, "repo")
+// newRepo creates a repository with demo.txt staged.
+func newRepo(t *testing.T) string {
+	t.Helper()
+	repo := filepath.Join(t.TempDir(), "repo")
 	if err := os.Mkdir(repo, 0o755); err != nil {
 		t.Fatal(err)
 	}
@@ -64,6 +71,12 @@ func TestSuggestPlainIntegration(t *testing.T) {
 	if out, err := add.CombinedOutput(); err != nil {
 		t.Fatalf("git add failed: %v\n%s", err, string(out))
 	}
+	return repo
+}
+
+func TestSuggestPlainIntegration(t *testing.T) {
+	binPath := buildBinary(t)
+	repo := newRepo(t)
 
 	suggest := exec.Command(binPath, "suggest", "--plain")
 	suggest.Dir = repo
@@ -89,3 +102,52 @@ func TestSuggestPlainIntegration(t *testing.T) {
 		t.Fatalf("empty suggestion")
 	}
 }
+
+func TestCommitIntegration(t *testing.T) {
+	binPath := buildBinary(t)
+	repo := newRepo(t)
+	t.Setenv("HOME", t.TempDir())
+
+	commit := exec.Command(binPath, "commit", "--signoff")
+	commit.Dir = repo
+	if out, err := commit.CombinedOutput(); err != nil {
+		t.Fatalf("commit failed: %v\n%s", err, string(out))
+	}
+
+	log := exec.Command("git", "log", "--format=%B")
+	log.Dir = repo
+	out, err := log.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "Signed-off-by: e2e <e2e@example.com>") || strings.HasPrefix(string(out), "\n") {
+		t.Errorf("unexpected commit message %q", string(out))
+	}
+
+	// Nothing is staged any more, so the command fails without committing
+	again := exec.Command(binPath, "commit")
+	again.Dir = repo
+	if err := again.Run(); err == nil {
+		t.Error("expected commit without staged changes to fail")
+	}
+
+	// git's own exit status is passed through
+	if err := os.WriteFile(filepath.Join(repo, "demo.txt"), []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	hook := filepath.Join(repo, ".git", "hooks", "pre-commit")
+	if err := os.WriteFile(hook, []byte("#!/bin/sh\nexit 1\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	add := exec.Command("git", "add", "demo.txt")
+	add.Dir = repo
+	if out, err := add.CombinedOutput(); err != nil {
+		t.Fatalf("git add failed: %v\n%s", err, string(out))
+	}
+	rejected := exec.Command(binPath, "commit")
+	rejected.Dir = repo
+	err = rejected.Run()
+	if ee, ok := err.(*exec.ExitError); !ok || ee.ExitCode() != 1 {
+		t.Errorf("expected git's exit status 1, got %v", err)
+	}
+}
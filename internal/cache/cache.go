@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -15,17 +17,172 @@ type CachedMessage struct {
 	DiffHash  string    `json:"diff_hash"`
 	Timestamp time.Time `json:"timestamp"`
 	Provider  string    `json:"provider"`
+	// Used is set once the message has been committed
+	Used bool `json:"used,omitempty"`
+	// Settings are what the message was generated with
+	Settings Settings `json:"settings"`
+	// Repo is the repository the message was cached in
+	Repo string `json:"repo,omitempty"`
+	// Latency is how long the provider took to write the message
+	Latency time.Duration `json:"latency,omitempty"`
+}
+
+// Settings are everything besides the changes that shapes a message. A
+// cached message is only reused with the settings it was generated with.
+type Settings struct {
+	// Providers are the configured backends, as provider:model
+	Providers []string `json:"providers,omitempty"`
+	// Conventions is a hash of the conventions given to the model
+	Conventions string `json:"conventions,omitempty"`
+	// Prompt is the version of the prompt template
+	Prompt int      `json:"prompt,omitempty"`
+	Body   bool     `json:"body,omitempty"`
+	Types  []string `json:"types,omitempty"`
+}
+
+// mismatch explains how s differs from want, or returns "" if it does not.
+func (s Settings) mismatch(want Settings) string {
+	switch {
+	case s.Prompt != want.Prompt:
+		return fmt.Sprintf("was generated with prompt version %d, not %d", s.Prompt, want.Prompt)
+	case !equalStrings(s.Providers, want.Providers):
+		return fmt.Sprintf("was generated for %s, not %s", listOrNone(s.Providers), listOrNone(want.Providers))
+	case s.Conventions != want.Conventions:
+		return "was generated with different conventions"
+	case s.Body != want.Body && want.Body:
+		return "has no body"
+	case s.Body != want.Body:
+		return "has a body"
+	case !equalStrings(s.Types, want.Types):
+		return fmt.Sprintf("was generated for types %s, not %s", listOrNone(s.Types), listOrNone(want.Types))
+	}
+	return ""
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func listOrNone(list []string) string {
+	if len(list) == 0 {
+		return "none"
+	}
+	return strings.Join(list, ", ")
+}
+
+// Options limits how long messages are kept and how much space they take.
+// Zero fields fall back to DefaultOptions.
+type Options struct {
+	// TTL is how long a message stays valid after it was generated
+	TTL time.Duration
+	// MaxEntries and MaxBytes bound the cache across all repositories;
+	// past either, the least recently used messages are evicted
+	MaxEntries int
+	MaxBytes   int64
+
+	// Settings are recorded with new messages and required of cached ones
+	Settings Settings
+}
+
+var DefaultOptions = Options{
+	TTL:        24 * time.Hour,
+	MaxEntries: 500,
+	MaxBytes:   5 << 20,
 }
 
 type Cache struct {
+	opts Options
+	// root holds the caches of every repository
+	root string
+	// repoDir holds the caches of every worktree of this repository
+	repoDir  string
 	cacheDir string
+	// repo names the repository and worktree for people
+	repo string
 }
 
-func New() *Cache {
+// New returns the cache of the repository and worktree in the current
+// directory, so that a message generated in one project is never offered in
+// another. Repositories are told apart by their git common dir and
+// worktrees by their git dir. Outside a repository, such as for suggest
+// --stdin, a shared cache is used.
+func New(opts Options) *Cache {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultOptions.TTL
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = DefaultOptions.MaxEntries
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultOptions.MaxBytes
+	}
+
 	homeDir, _ := os.UserHomeDir()
-	cacheDir := filepath.Join(homeDir, ".cache", "commitgen")
-	_ = os.MkdirAll(cacheDir, 0755) // ignore error, cache is optional
-	return &Cache{cacheDir: cacheDir}
+	root := filepath.Join(homeDir, ".cache", "commitgen")
+
+	c := &Cache{opts: opts, root: root, repoDir: filepath.Join(root, "shared")}
+	c.cacheDir = c.repoDir
+	if common, gitDir, err := gitDirs(); err == nil {
+		c.repoDir = filepath.Join(root, "repos", hashPath(common))
+		c.cacheDir = filepath.Join(c.repoDir, hashPath(gitDir))
+		c.repo = repoName(common, gitDir)
+	}
+
+	_ = os.MkdirAll(c.cacheDir, 0755) // ignore error, cache is optional
+	return c
+}
+
+// repoName returns the directory of the repository, followed by the name of
+// the worktree for a linked one, e.g. "/src/app [review]".
+func repoName(common, gitDir string) string {
+	name := common
+	if filepath.Base(common) == ".git" {
+		name = filepath.Dir(common)
+	}
+	if gitDir != common {
+		name += " [" + filepath.Base(gitDir) + "]"
+	}
+	return name
+}
+
+// gitDirs returns the absolute common dir of the repository in the current
+// directory, shared by all its worktrees, and the git dir of the worktree.
+func gitDirs() (common, gitDir string, err error) {
+	out, err := exec.Command("git", "rev-parse", "--git-common-dir", "--absolute-git-dir").Output()
+	if err != nil {
+		return "", "", err
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 2 {
+		return "", "", fmt.Errorf("unexpected git rev-parse output %q", out)
+	}
+
+	// The common dir is relative to the current directory unless it is
+	// outside it
+	common, err = filepath.Abs(lines[0])
+	if err != nil {
+		return "", "", err
+	}
+	return canonical(common), canonical(lines[1]), nil
+}
+
+func canonical(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return filepath.Clean(path)
+}
+
+func hashPath(path string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(path)))[:16]
 }
 
 func (c *Cache) GetCacheKey(files []string, patch string) string {
@@ -42,24 +199,36 @@ func (c *Cache) Get(files []string, patch string) (*CachedMessage, error) {
 	cachePath := filepath.Join(c.cacheDir, key+".json")
 
 	data, err := os.ReadFile(cachePath)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no message is cached for these changes")
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	var cached CachedMessage
 	if err := json.Unmarshal(data, &cached); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("cached message is unreadable: %w", err)
 	}
 
-	if time.Since(cached.Timestamp) > 24*time.Hour {
+	if c.expired(cached) {
 		os.Remove(cachePath)
-		return nil, fmt.Errorf("cache expired")
+		return nil, fmt.Errorf("cached message expired %s ago", time.Since(cached.Timestamp.Add(c.opts.TTL)).Round(time.Second))
+	}
+	if reason := cached.Settings.mismatch(c.opts.Settings); reason != "" {
+		return nil, fmt.Errorf("cached message %s", reason)
 	}
 
+	// The modification time records the last use for eviction
+	now := time.Now()
+	_ = os.Chtimes(cachePath, now, now)
+
 	return &cached, nil
 }
 
-func (c *Cache) Set(files []string, patch string, message string, provider string) error {
+// Set caches message for files and patch. latency is how long the provider
+// took, or zero for heuristics; cache stats report it as time saved.
+func (c *Cache) Set(files []string, patch string, message string, provider string, latency time.Duration) error {
 	key := c.GetCacheKey(files, patch)
 	cachePath := filepath.Join(c.cacheDir, key+".json")
 
@@ -69,52 +238,71 @@ func (c *Cache) Set(files []string, patch string, message string, provider strin
 		DiffHash:  key,
 		Timestamp: time.Now(),
 		Provider:  provider,
+		Settings:  c.opts.Settings,
+		Repo:      c.repo,
+		Latency:   latency,
 	}
 
-	data, err := json.Marshal(cached)
-	if err != nil {
+	if err := c.write(cachePath, cached); err != nil {
 		return err
 	}
-
-	return os.WriteFile(cachePath, data, 0644)
+	_, err := c.evict()
+	return err
 }
 
-func (c *Cache) GetLatest() (*CachedMessage, error) {
-	entries, err := os.ReadDir(c.cacheDir)
+// MarkUsed records that the message cached for these changes has been
+// committed, so that it is no longer offered for them.
+func (c *Cache) MarkUsed(files []string, patch string) error {
+	cached, err := c.Get(files, patch)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	cached.Used = true
+	return c.write(filepath.Join(c.cacheDir, cached.DiffHash+".json"), *cached)
+}
 
-	var latest *CachedMessage
-	var latestTime time.Time
-
-	for _, entry := range entries {
-		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".json" {
-			cachePath := filepath.Join(c.cacheDir, entry.Name())
-			data, err := os.ReadFile(cachePath)
-			if err != nil {
-				continue
-			}
-
-			var cached CachedMessage
-			if err := json.Unmarshal(data, &cached); err != nil {
-				continue
-			}
-
-			if cached.Timestamp.After(latestTime) {
-				latest = &cached
-				latestTime = cached.Timestamp
-			}
-		}
+func (c *Cache) write(cachePath string, cached CachedMessage) error {
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return err
 	}
+	return writeFile(cachePath, data)
+}
 
-	if latest == nil {
-		return nil, fmt.Errorf("no cached messages found")
+func writeFile(cachePath string, data []byte) error {
+	// Clear or Prune may have removed the directory
+	dir := filepath.Dir(cachePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
 	}
 
-	return latest, nil
+	// Write a temporary file and rename it into place, so that readers
+	// such as the prepare-commit-msg hook never see a partial entry
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails once renamed
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), cachePath)
 }
 
+// Clear removes the cached messages of this repository, in all its
+// worktrees.
 func (c *Cache) Clear() error {
-	return os.RemoveAll(c.cacheDir)
+	return os.RemoveAll(c.repoDir)
+}
+
+// ClearAll removes the cached messages of every repository.
+func (c *Cache) ClearAll() error {
+	return os.RemoveAll(c.root)
 }
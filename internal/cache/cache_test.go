@@ -0,0 +1,326 @@
+package cache
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// inDir runs the rest of the test in dir.
+func inDir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+}
+
+func gitInit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"init", "-q"}, args...)...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+}
+
+func TestMarkUsed(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	inDir(t, t.TempDir())
+	c := New(Options{})
+
+	files, patch := []string{"main.go"}, "+hello"
+	if err := c.Set(files, patch, "feat: say hello", "heuristics", 0); err != nil {
+		t.Fatal(err)
+	}
+	if cached, err := c.Get(files, patch); err != nil || cached.Used {
+		t.Fatalf("Get() = %v, %v", cached, err)
+	}
+
+	if err := c.MarkUsed(files, patch); err != nil {
+		t.Fatal(err)
+	}
+	if cached, err := c.Get(files, patch); err != nil || !cached.Used {
+		t.Errorf("expected the entry to stay, marked used, got %v, %v", cached, err)
+	}
+}
+
+func TestCacheIsScopedToRepository(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	one, other := t.TempDir(), t.TempDir()
+	gitInit(t, one)
+	gitInit(t, other)
+	files, patch := []string{"main.go"}, "+hello"
+
+	inDir(t, one)
+	if err := New(Options{}).Set(files, patch, "feat: say hello", "heuristics", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll("sub", 0755); err != nil {
+		t.Fatal(err)
+	}
+	inDir(t, filepath.Join(one, "sub"))
+	if _, err := New(Options{}).Get(files, patch); err != nil {
+		t.Errorf("expected a hit from a subdirectory of the same repository: %v", err)
+	}
+
+	inDir(t, other)
+	if cached, err := New(Options{}).Get(files, patch); err == nil {
+		t.Errorf("expected a miss in another repository, got %q", cached.Message)
+	}
+}
+
+func TestCacheIsScopedToWorktree(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	primary, linked := t.TempDir(), filepath.Join(t.TempDir(), "linked")
+	gitInit(t, primary)
+	for _, args := range [][]string{
+		{"-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "-q", "--allow-empty", "-m", "init"},
+		{"worktree", "add", "-q", linked},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = primary
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	files, patch := []string{"main.go"}, "+hello"
+
+	inDir(t, primary)
+	c := New(Options{})
+	if err := c.Set(files, patch, "feat: say hello", "heuristics", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	inDir(t, linked)
+	if cached, err := New(Options{}).Get(files, patch); err == nil {
+		t.Errorf("expected a miss in another worktree, got %q", cached.Message)
+	}
+	if err := New(Options{}).Set(files, patch, "feat: greet", "heuristics", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Clearing removes the entries of every worktree of the repository
+	if err := c.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(Options{}).Get(files, patch); err == nil {
+		t.Error("expected Clear to remove the linked worktree's entries")
+	}
+}
+
+func TestGetSkipsExpired(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	inDir(t, t.TempDir())
+	c := New(Options{TTL: time.Hour})
+
+	files, patch := []string{"main.go"}, "+hello"
+	key := c.GetCacheKey(files, patch)
+	stale := CachedMessage{Message: "feat: say hello", Files: files, DiffHash: key, Timestamp: time.Now().Add(-2 * time.Hour)}
+	if err := c.write(filepath.Join(c.cacheDir, key+".json"), stale); err != nil {
+		t.Fatal(err)
+	}
+
+	if cached, err := c.Get(files, patch); err == nil {
+		t.Errorf("expected an expired entry to be skipped, got %q", cached.Message)
+	}
+	if _, err := os.Stat(filepath.Join(c.cacheDir, key+".json")); !os.IsNotExist(err) {
+		t.Errorf("expected the expired entry to be removed, got %v", err)
+	}
+}
+
+func TestSetEvictsLeastRecentlyUsed(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	inDir(t, t.TempDir())
+	c := New(Options{MaxEntries: 2})
+
+	for i, patch := range []string{"+a", "+b"} {
+		if err := c.Set([]string{"main.go"}, patch, "feat: "+patch, "heuristics", 0); err != nil {
+			t.Fatal(err)
+		}
+		// Make the order of use unambiguous
+		past := time.Now().Add(time.Duration(i-2) * time.Hour)
+		path := filepath.Join(c.cacheDir, c.GetCacheKey([]string{"main.go"}, patch)+".json")
+		if err := os.Chtimes(path, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Reading +a makes +b the least recently used
+	if _, err := c.Get([]string{"main.go"}, "+a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set([]string{"main.go"}, "+c", "feat: +c", "heuristics", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for patch, want := range map[string]bool{"+a": true, "+b": false, "+c": true} {
+		if _, err := c.Get([]string{"main.go"}, patch); (err == nil) != want {
+			t.Errorf("Get(%s): cached = %v, want %v", patch, err == nil, want)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	inDir(t, t.TempDir())
+	c := New(Options{TTL: time.Hour, MaxBytes: 1 << 20})
+
+	if err := c.Set([]string{"main.go"}, "+fresh", "feat: fresh", "heuristics", 0); err != nil {
+		t.Fatal(err)
+	}
+	key := c.GetCacheKey([]string{"main.go"}, "+stale")
+	stale := CachedMessage{Message: "feat: stale", DiffHash: key, Timestamp: time.Now().Add(-2 * time.Hour)}
+	if err := c.write(filepath.Join(c.cacheDir, key+".json"), stale); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := c.Prune()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Expired != 1 || result.Evicted != 0 || result.Remaining != 1 || result.Bytes == 0 {
+		t.Errorf("Prune() = %+v, want 1 expired and 1 remaining", result)
+	}
+
+	// Tightening the limit evicts what is left
+	c.opts.MaxBytes = 1
+	if result, err := c.Prune(); err != nil || result.Evicted != 1 || result.Remaining != 0 {
+		t.Errorf("Prune() = %+v, %v, want 1 evicted", result, err)
+	}
+}
+
+func TestConcurrentReadersNeverSeePartialEntries(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	inDir(t, t.TempDir())
+	c := New(Options{})
+	files, patch := []string{"main.go"}, "+hello"
+	if err := c.Set(files, patch, "feat: say hello", "heuristics", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			if err := c.Set(files, patch, strings.Repeat("feat: say hello ", i%20+1), "heuristics", 0); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if _, err := c.Get(files, patch); err != nil {
+			t.Fatalf("Get() during writes: %v", err)
+		}
+	}
+}
+
+func TestGetRequiresSameSettings(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	inDir(t, t.TempDir())
+	settings := Settings{Providers: []string{"openai:gpt-4o"}, Conventions: "abc", Prompt: 1}
+	files, patch := []string{"main.go"}, "+hello"
+	if err := New(Options{Settings: settings}).Set(files, patch, "feat: say hello", "openai", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(Options{Settings: settings}).Get(files, patch); err != nil {
+		t.Fatalf("expected a hit with the same settings: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(*Settings)
+		reason string
+	}{
+		{"model", func(s *Settings) { s.Providers = []string{"openai:gpt-4.1"} }, "was generated for openai:gpt-4o, not openai:gpt-4.1"},
+		{"conventions", func(s *Settings) { s.Conventions = "def" }, "different conventions"},
+		{"prompt", func(s *Settings) { s.Prompt = 2 }, "prompt version 1, not 2"},
+		{"body", func(s *Settings) { s.Body = true }, "has no body"},
+		{"types", func(s *Settings) { s.Types = []string{"feat"} }, "types none, not feat"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := settings
+			tt.change(&want)
+			_, err := New(Options{Settings: want}).Get(files, patch)
+			if err == nil || !strings.Contains(err.Error(), tt.reason) {
+				t.Errorf("Get() error = %v, want it to mention %q", err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	ci, dev := t.TempDir(), t.TempDir()
+	gitInit(t, ci)
+	gitInit(t, dev)
+	settings := Settings{Providers: []string{"openai:gpt-4o"}, Prompt: 1}
+	files, patch := []string{"main.go"}, "+hello"
+
+	inDir(t, ci)
+	if err := New(Options{Settings: settings}).Set(files, patch, "feat: say hello", "openai", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	var exported strings.Builder
+	if n, err := New(Options{}).Export(&exported, false); err != nil || n != 1 {
+		t.Fatalf("Export() = %d, %v", n, err)
+	}
+
+	inDir(t, dev)
+	c := New(Options{Settings: settings})
+	if n, err := c.Import(strings.NewReader(exported.String())); err != nil || n != 1 {
+		t.Fatalf("Import() = %d, %v", n, err)
+	}
+	cached, err := c.Get(files, patch)
+	if err != nil || cached.Message != "feat: say hello" || cached.Latency != time.Second {
+		t.Fatalf("Get() after import = %+v, %v", cached, err)
+	}
+	if list, err := c.List(false); err != nil || len(list) != 1 || !strings.HasSuffix(list[0].Repo, filepath.Base(dev)) {
+		t.Errorf("List() = %+v, %v", list, err)
+	}
+
+	if _, err := c.Import(strings.NewReader(`{"diff_hash": "../../escape", "timestamp": "` + time.Now().Format(time.RFC3339) + `"}`)); err == nil {
+		t.Error("expected an invalid key to be rejected")
+	}
+}
+
+func TestStats(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	inDir(t, t.TempDir())
+	c := New(Options{})
+
+	for _, latency := range []time.Duration{0, 2 * time.Second, 4 * time.Second} {
+		if err := c.RecordHit(&CachedMessage{Latency: latency}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.RecordMiss(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.Stats()
+	want := Stats{Hits: 3, Misses: 1, AIHits: 2, Saved: 6 * time.Second}
+	if err != nil || got != want {
+		t.Errorf("Stats() = %+v, %v, want %+v", got, err, want)
+	}
+
+	// The index is never taken for a cached message
+	if list, err := c.List(true); err != nil || len(list) != 0 {
+		t.Errorf("List() = %+v, %v, want nothing", list, err)
+	}
+}
@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Entry is a cached message as stored on disk.
+type Entry struct {
+	CachedMessage
+	Path string
+	Size int64
+}
+
+// List returns the cached messages of every repository, newest first,
+// skipping unreadable ones. With all unset it only lists this repository.
+func (c *Cache) List(all bool) ([]Entry, error) {
+	dir := c.repoDir
+	if all {
+		dir = c.root
+	}
+	files, err := entriesIn(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Entry
+	for _, f := range files {
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			continue
+		}
+		e := Entry{Path: f.path, Size: f.size}
+		if json.Unmarshal(data, &e.CachedMessage) != nil {
+			continue
+		}
+		list = append(list, e)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Timestamp.After(list[j].Timestamp)
+	})
+	return list, nil
+}
+
+// Find returns the cached messages of every repository whose key starts
+// with prefix.
+func (c *Cache) Find(prefix string) ([]Entry, error) {
+	list, err := c.List(true)
+	if err != nil {
+		return nil, err
+	}
+	var found []Entry
+	for _, e := range list {
+		if prefix != "" && strings.HasPrefix(e.DiffHash, prefix) {
+			found = append(found, e)
+		}
+	}
+	return found, nil
+}
+
+// Export writes the messages of this repository, or of every repository
+// with all set, as JSON lines, returning how many it wrote.
+func (c *Cache) Export(w io.Writer, all bool) (int, error) {
+	list, err := c.List(all)
+	if err != nil {
+		return 0, err
+	}
+	enc := json.NewEncoder(w)
+	for i, e := range list {
+		if err := enc.Encode(e.CachedMessage); err != nil {
+			return i, err
+		}
+	}
+	return len(list), nil
+}
+
+// validKey matches the keys GetCacheKey returns, which name the entry
+// files, so that an imported key cannot point outside the cache.
+var validKey = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// Import reads messages written by Export into the cache of this worktree,
+// returning how many it stored. Each keeps the key, timestamp and settings
+// it was exported with, so it is only used for the same changes and
+// settings, and only until it expires. Expired messages are skipped.
+func (c *Cache) Import(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+
+	imported := 0
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var cached CachedMessage
+		if err := json.Unmarshal([]byte(text), &cached); err != nil {
+			return imported, fmt.Errorf("line %d: %w", line, err)
+		}
+		if !validKey.MatchString(cached.DiffHash) {
+			return imported, fmt.Errorf("line %d: invalid key %q", line, cached.DiffHash)
+		}
+		if c.expired(cached) {
+			continue
+		}
+
+		cached.Repo = c.repo
+		if err := c.write(filepath.Join(c.cacheDir, cached.DiffHash+".json"), cached); err != nil {
+			return imported, err
+		}
+		imported++
+	}
+	if err := scanner.Err(); err != nil {
+		return imported, err
+	}
+
+	_, err := c.evict()
+	return imported, err
+}
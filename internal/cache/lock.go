@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockPoll is how often a waiting Lock retries.
+const lockPoll = 50 * time.Millisecond
+
+// lockWait bounds how long Lock waits for another process's generation,
+// which may be stuck on a slow provider; the caller then generates on its
+// own. It is a variable so that tests can shorten it.
+var lockWait = 10 * time.Second
+
+// Lock takes the generation lock for files and patch, waiting while another
+// process, such as the post-index-change hook, holds it. Callers check the
+// cache once they have the lock, so that a message generated in the
+// meantime is used instead of asking a provider again. Lock gives up with
+// context.DeadlineExceeded after lockWait. The lock is an advisory flock on
+// a file next to the entry; where flock is unavailable, Lock never waits.
+func (c *Cache) Lock(ctx context.Context, files []string, patch string) (unlock func(), err error) {
+	ctx, cancel := context.WithTimeout(ctx, lockWait)
+	defer cancel()
+	return lockFile(ctx, filepath.Join(c.cacheDir, c.GetCacheKey(files, patch)+".lock"))
+}
+
+// lockFile takes an exclusive lock on path, creating it, and removes it
+// again on unlock.
+func lockFile(ctx context.Context, path string) (unlock func(), err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return nil, err
+		}
+
+		locked, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if locked {
+			// The previous holder removes the file on unlock, so make
+			// sure the lock is on the file that is still there
+			held, _ := f.Stat()
+			current, err := os.Stat(path)
+			if err == nil && os.SameFile(held, current) {
+				return func() {
+					os.Remove(path)
+					f.Close()
+				}, nil
+			}
+			f.Close()
+			continue
+		}
+		f.Close()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPoll):
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package cache
+
+import "os"
+
+// tryLock always succeeds: without flock, concurrent generations are not
+// deduplicated, but writes are still atomic.
+func tryLock(f *os.File) (bool, error) {
+	return true, nil
+}
@@ -0,0 +1,78 @@
+//go:build unix
+
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLockWaitsForHolder(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	inDir(t, t.TempDir())
+	c := New(Options{})
+	files, patch := []string{"main.go"}, "+hello"
+
+	unlock, err := c.Lock(context.Background(), files, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		unlock, err := New(Options{}).Lock(context.Background(), files, patch)
+		if err != nil {
+			t.Error(err)
+		} else {
+			unlock()
+		}
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("expected Lock to wait while the lock is held")
+	case <-time.After(3 * lockPoll):
+	}
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("expected Lock to succeed once the lock was released")
+	}
+}
+
+func TestLockGivesUpWhenCancelled(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	inDir(t, t.TempDir())
+	c := New(Options{})
+	files, patch := []string{"main.go"}, "+hello"
+
+	unlock, err := c.Lock(context.Background(), files, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*lockPoll)
+	defer cancel()
+	if _, err := c.Lock(ctx, files, patch); err != context.DeadlineExceeded {
+		t.Errorf("Lock() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Nor does it wait for a stuck holder for ever
+	original := lockWait
+	lockWait = 2 * lockPoll
+	defer func() { lockWait = original }()
+	if _, err := c.Lock(context.Background(), files, patch); err != context.DeadlineExceeded {
+		t.Errorf("Lock() after lockWait = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Another key is not held up
+	other, err := c.Lock(context.Background(), files, "+other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other()
+}
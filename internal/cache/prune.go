@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// PruneResult reports what Prune removed and what is left.
+type PruneResult struct {
+	Expired   int
+	Evicted   int
+	Remaining int
+	Bytes     int64
+}
+
+// entry is one cached message on disk.
+type entry struct {
+	path    string
+	size    int64
+	lastUse time.Time
+}
+
+func (c *Cache) expired(cached CachedMessage) bool {
+	return time.Since(cached.Timestamp) > c.opts.TTL
+}
+
+// Prune removes expired messages from the caches of every repository, then
+// evicts the least recently used ones until the cache is within its limits.
+func (c *Cache) Prune() (PruneResult, error) {
+	var result PruneResult
+	entries, err := c.entries()
+	if err != nil {
+		return result, err
+	}
+
+	for _, e := range entries {
+		data, err := os.ReadFile(e.path)
+		if err != nil {
+			continue
+		}
+		var cached CachedMessage
+		if json.Unmarshal(data, &cached) == nil && !c.expired(cached) {
+			continue
+		}
+		// Unreadable entries are as good as expired
+		if os.Remove(e.path) == nil {
+			result.Expired++
+		}
+	}
+
+	result.Evicted, err = c.evict()
+	if err != nil {
+		return result, err
+	}
+
+	entries, err = c.entries()
+	result.Remaining = len(entries)
+	for _, e := range entries {
+		result.Bytes += e.size
+	}
+	removeEmptyDirs(filepath.Join(c.root, "repos"))
+	return result, err
+}
+
+// evict removes the least recently used messages while the cache holds more
+// than MaxEntries of them or more than MaxBytes, returning how many it
+// removed. It only looks at file sizes and times, so it is cheap enough to
+// run after every write.
+func (c *Cache) evict() (int, error) {
+	entries, err := c.entries()
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, e := range entries {
+		total += e.size
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].lastUse.Before(entries[j].lastUse)
+	})
+
+	evicted := 0
+	for _, e := range entries {
+		if len(entries)-evicted <= c.opts.MaxEntries && total <= c.opts.MaxBytes {
+			break
+		}
+		if err := os.Remove(e.path); err != nil && !os.IsNotExist(err) {
+			return evicted, err
+		}
+		evicted++
+		total -= e.size
+	}
+	return evicted, nil
+}
+
+// entries lists the cached messages of every repository.
+func (c *Cache) entries() ([]entry, error) {
+	return entriesIn(c.root)
+}
+
+// entriesIn lists the cached messages stored under dir.
+func entriesIn(dir string) ([]entry, error) {
+	var entries []entry
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // removed in the meantime
+		}
+		entries = append(entries, entry{path: path, size: info.Size(), lastUse: info.ModTime()})
+		return nil
+	})
+	return entries, err
+}
+
+// removeEmptyDirs removes the directories of repositories and worktrees
+// that no longer hold any messages.
+func removeEmptyDirs(dir string) {
+	children, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, child := range children {
+		if !child.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, child.Name())
+		removeEmptyDirs(path)
+		// Fails unless the directory is empty
+		_ = os.Remove(path)
+	}
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Stats counts how often cached messages were used, across all
+// repositories.
+type Stats struct {
+	Hits   int `json:"hits"`
+	Misses int `json:"misses"`
+	// AIHits are the hits on messages a provider wrote, and Saved is the
+	// time the provider took to write them
+	AIHits int           `json:"ai_hits"`
+	Saved  time.Duration `json:"saved"`
+}
+
+// statsWait bounds how long recording a lookup waits for another process
+// recording one; the count is dropped rather than delay a commit.
+const statsWait = time.Second
+
+func (c *Cache) statsPath() string {
+	// Not .json, so that it is never taken for a cached message
+	return filepath.Join(c.root, "stats")
+}
+
+// Stats returns the recorded hits and misses.
+func (c *Cache) Stats() (Stats, error) {
+	var stats Stats
+	data, err := os.ReadFile(c.statsPath())
+	if os.IsNotExist(err) {
+		return stats, nil
+	}
+	if err != nil {
+		return stats, err
+	}
+	return stats, json.Unmarshal(data, &stats)
+}
+
+// RecordHit counts a lookup that was answered with cached.
+func (c *Cache) RecordHit(cached *CachedMessage) error {
+	return c.updateStats(func(s *Stats) {
+		s.Hits++
+		if cached.Latency > 0 {
+			s.AIHits++
+			s.Saved += cached.Latency
+		}
+	})
+}
+
+// RecordMiss counts a lookup that found no usable message.
+func (c *Cache) RecordMiss() error {
+	return c.updateStats(func(s *Stats) { s.Misses++ })
+}
+
+func (c *Cache) updateStats(update func(*Stats)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), statsWait)
+	defer cancel()
+	unlock, err := lockFile(ctx, c.statsPath()+".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Start over if the index is unreadable
+	stats, _ := c.Stats()
+	update(&stats)
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	return writeFile(c.statsPath(), data)
+}
@@ -2,28 +2,86 @@ package config
 
 import (
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/joaquinalmora/commitgen/internal/cache"
+	"github.com/joaquinalmora/commitgen/internal/provider"
 	"github.com/joho/godotenv"
 	"gopkg.in/yaml.v3"
 )
 
+// ProviderEntry is one backend in the ai.providers fallback chain. In YAML it
+// can be written as a bare name or as a mapping with per-backend settings.
+type ProviderEntry struct {
+	Name    string `yaml:"name"`
+	Model   string `yaml:"model"`
+	APIKey  string `yaml:"api_key"`
+	BaseURL string `yaml:"base_url"`
+	Timeout string `yaml:"timeout"`
+	Retries *int   `yaml:"retries"`
+}
+
+func (e *ProviderEntry) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		e.Name = node.Value
+		return nil
+	}
+	type plain ProviderEntry
+	return node.Decode((*plain)(e))
+}
+
 type Config struct {
 	AI struct {
-		Enabled  bool   `yaml:"enabled"`
-		Provider string `yaml:"provider"`
-		APIKey   string `yaml:"api_key"`
-		Model    string `yaml:"model"`
-		BaseURL  string `yaml:"base_url"`
+		Enabled   bool            `yaml:"enabled"`
+		Provider  string          `yaml:"provider"`
+		Providers []ProviderEntry `yaml:"providers"`
+		APIKey    string          `yaml:"api_key"`
+		Model     string          `yaml:"model"`
+		BaseURL   string          `yaml:"base_url"`
+		Timeout   string          `yaml:"timeout"`
+		Body      bool            `yaml:"body"`
+
+		// Secrets is what to do about secrets in the diff: "redact"
+		// (default), "block" to skip the AI call, or "off"
+		Secrets string `yaml:"secrets"`
+
+		// TokenBudgets overrides the prompt budget per model name
+		TokenBudgets map[string]int `yaml:"token_budgets"`
 	} `yaml:"ai"`
 
 	Performance struct {
-		PatchBytes int    `yaml:"patch_bytes"`
-		CacheTTL   string `yaml:"cache_ttl"`
-		MaxFiles   int    `yaml:"max_files"`
+		PatchBytes     int    `yaml:"patch_bytes"`
+		CacheTTL       string `yaml:"cache_ttl"`
+		MaxFiles       int    `yaml:"max_files"`
+		MaxRetries     *int   `yaml:"max_retries"`
+		RetryBaseDelay string `yaml:"retry_base_delay"`
+		RetryMaxDelay  string `yaml:"retry_max_delay"`
+
+		// CacheMaxEntries and CacheMaxBytes bound the message cache
+		// across all repositories
+		CacheMaxEntries int   `yaml:"cache_max_entries"`
+		CacheMaxBytes   int64 `yaml:"cache_max_bytes"`
 	} `yaml:"performance"`
 
+	// Diff chooses which files' hunks are sent to the model, in .gitignore
+	// syntax on top of .commitgenignore and the built-in excludes
+	Diff struct {
+		Exclude []string `yaml:"exclude"`
+		Include []string `yaml:"include"`
+	} `yaml:"diff"`
+
+	// Scopes maps globs in .gitignore syntax to conventional-commit scopes
+	Scopes map[string]string `yaml:"scopes"`
+
+	// Types lists the conventional-commit types messages may use; empty
+	// allows any
+	Types []string `yaml:"types"`
+
 	Git struct {
 		AutoInstallHook bool   `yaml:"auto_install_hook"`
 		CommitTemplate  string `yaml:"commit_template"`
@@ -46,29 +104,64 @@ type Config struct {
 	UseAIFallback bool
 }
 
+// packageFiles are the names of a package's own config in a monorepo.
+var packageFiles = []string{"commitgen.yaml", "commitgen.yml"}
+
 func Load() Config {
+	return LoadFor(".")
+}
+
+// LoadFor loads the configuration for the monorepo package in dir, relative
+// to the repository root: the commitgen.yaml of every directory from the
+// root down to dir is merged over the usual config, the nearest last. A
+// package config can set the provider and model, the conventions file, the
+// allowed types and scopes; environment variables still take precedence.
+func LoadFor(dir string) Config {
 	loadEnvFiles()
 
 	var cfg Config
 
 	cfg = loadFromYAML(cfg)
+	for _, d := range parentDirs(dir) {
+		cfg = mergePackage(cfg, d)
+	}
 
 	cfg.AI.Enabled = getEnvBool("COMMITGEN_AI", cfg.AI.Enabled)
-	cfg.AI.Provider = "openai"
+	cfg.AI.Provider = strings.ToLower(getEnv("COMMITGEN_PROVIDER", cfg.AI.Provider))
+	cfg.AI.Body = getEnvBool("COMMITGEN_BODY", cfg.AI.Body)
+	cfg.AI.Secrets = strings.ToLower(getEnv("COMMITGEN_SECRETS", cfg.AI.Secrets))
+
+	if chain := getEnv("COMMITGEN_PROVIDERS", ""); chain != "" {
+		cfg.AI.Providers = nil
+		for _, name := range strings.Split(chain, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				cfg.AI.Providers = append(cfg.AI.Providers, ProviderEntry{Name: name})
+			}
+		}
+	}
+	if len(cfg.AI.Providers) > 0 {
+		// The first backend in the chain is the primary provider
+		cfg.AI.Provider = strings.ToLower(cfg.AI.Providers[0].Name)
+	}
 
-	// Always use OpenAI API key
-	if apiKey := getEnv("OPENAI_API_KEY", ""); apiKey != "" {
-		cfg.AI.APIKey = apiKey
+	// Defaults come from the provider's registered factory; an unknown name
+	// is left as-is so provider.GetProvider can report it.
+	factory, _ := provider.Lookup(cfg.AI.Provider)
+
+	if factory.APIKeyEnv != "" {
+		if apiKey := getEnv(factory.APIKeyEnv, ""); apiKey != "" {
+			cfg.AI.APIKey = apiKey
+		}
 	}
 
 	cfg.AI.Model = getEnv("COMMITGEN_MODEL", cfg.AI.Model)
 	if cfg.AI.Model == "" {
-		cfg.AI.Model = "gpt-4o-mini"
+		cfg.AI.Model = factory.DefaultModel
 	}
 
 	cfg.AI.BaseURL = getEnv("COMMITGEN_BASE_URL", cfg.AI.BaseURL)
 	if cfg.AI.BaseURL == "" {
-		cfg.AI.BaseURL = "https://api.openai.com/v1"
+		cfg.AI.BaseURL = factory.DefaultBaseURL
 	}
 
 	cfg.Performance.MaxFiles = getEnvInt("COMMITGEN_MAX_FILES", cfg.Performance.MaxFiles)
@@ -81,6 +174,10 @@ func Load() Config {
 		cfg.Performance.PatchBytes = 100 * 1024
 	}
 
+	if retries := getEnvInt("COMMITGEN_MAX_RETRIES", -1); retries >= 0 {
+		cfg.Performance.MaxRetries = &retries
+	}
+
 	cfg.MaxFiles = cfg.Performance.MaxFiles
 	cfg.PatchBytes = cfg.Performance.PatchBytes
 	cfg.UseAIFallback = getEnvBool("COMMITGEN_AI_FALLBACK", true)
@@ -88,9 +185,111 @@ func Load() Config {
 	return cfg
 }
 
+// ProviderConfigs resolves the fallback chain into provider configurations,
+// filling keys, models and base URLs from each backend's registered
+// defaults. Without ai.providers the chain is just ai.provider.
+func (c Config) ProviderConfigs() []provider.Config {
+	entries := c.AI.Providers
+	if len(entries) == 0 {
+		entries = []ProviderEntry{{
+			Name:    c.AI.Provider,
+			Model:   c.AI.Model,
+			APIKey:  c.AI.APIKey,
+			BaseURL: c.AI.BaseURL,
+		}}
+	}
+
+	configs := make([]provider.Config, 0, len(entries))
+	for i, e := range entries {
+		name := strings.ToLower(e.Name)
+		factory, _ := provider.Lookup(name)
+
+		pc := provider.Config{
+			Provider: name,
+			APIKey:   e.APIKey,
+			Model:    e.Model,
+			BaseURL:  e.BaseURL,
+			Timeout:  parseDuration(e.Timeout, parseDuration(c.AI.Timeout, 0)),
+			Retry:    c.RetryPolicy(),
+			Body:     c.AI.Body,
+
+			ConventionsFile: c.Advanced.ConventionsFile,
+			Types:           c.Types,
+		}
+		if e.Retries != nil {
+			pc.Retry.MaxRetries = *e.Retries
+		}
+
+		// The primary backend inherits the top-level ai.* settings and the
+		// COMMITGEN_* overrides already applied to them
+		if i == 0 && name == c.AI.Provider {
+			if pc.APIKey == "" {
+				pc.APIKey = c.AI.APIKey
+			}
+			if pc.Model == "" {
+				pc.Model = c.AI.Model
+			}
+			if pc.BaseURL == "" {
+				pc.BaseURL = c.AI.BaseURL
+			}
+		}
+
+		if pc.APIKey == "" && factory.APIKeyEnv != "" {
+			pc.APIKey = os.Getenv(factory.APIKeyEnv)
+		}
+		if pc.Model == "" {
+			pc.Model = factory.DefaultModel
+		}
+		if pc.BaseURL == "" {
+			pc.BaseURL = factory.DefaultBaseURL
+		}
+		pc.TokenBudget = c.AI.TokenBudgets[pc.Model]
+		pc.MaxFiles = c.Performance.MaxFiles
+
+		configs = append(configs, pc)
+	}
+
+	return configs
+}
+
+// RetryPolicy returns the HTTP retry budget from the performance section,
+// falling back to provider.DefaultRetryPolicy for anything unset.
+func (c Config) RetryPolicy() provider.RetryPolicy {
+	policy := provider.DefaultRetryPolicy
+	if c.Performance.MaxRetries != nil && *c.Performance.MaxRetries >= 0 {
+		policy.MaxRetries = *c.Performance.MaxRetries
+	}
+	policy.BaseDelay = parseDuration(c.Performance.RetryBaseDelay, policy.BaseDelay)
+	policy.MaxDelay = parseDuration(c.Performance.RetryMaxDelay, policy.MaxDelay)
+	return policy
+}
+
+// CacheOptions returns the cache limits from the performance section,
+// falling back to cache.DefaultOptions for anything unset or invalid, and
+// the settings cached messages must have been generated with.
+func (c Config) CacheOptions() cache.Options {
+	var providers []string
+	for _, pc := range c.ProviderConfigs() {
+		providers = append(providers, pc.Provider+":"+pc.Model)
+	}
+
+	return cache.Options{
+		TTL:        parseDuration(c.Performance.CacheTTL, cache.DefaultOptions.TTL),
+		MaxEntries: c.Performance.CacheMaxEntries,
+		MaxBytes:   c.Performance.CacheMaxBytes,
+		Settings: cache.Settings{
+			Providers:   providers,
+			Conventions: provider.ConventionsHash(c.Advanced.ConventionsFile),
+			Prompt:      provider.PromptVersion,
+			Body:        c.AI.Body,
+			Types:       c.Types,
+		},
+	}
+}
+
 func loadFromYAML(cfg Config) Config {
 	cfg.AI.Provider = "openai"
-	cfg.AI.Model = "gpt-4o-mini"
+	cfg.AI.Secrets = "redact"
 	cfg.Performance.PatchBytes = 100 * 1024
 	cfg.Performance.MaxFiles = 10
 	cfg.Performance.CacheTTL = "24h"
@@ -128,7 +327,21 @@ func loadFromYAML(cfg Config) Config {
 				if yamlCfg.AI.BaseURL != "" {
 					cfg.AI.BaseURL = yamlCfg.AI.BaseURL
 				}
+				if len(yamlCfg.AI.Providers) > 0 {
+					cfg.AI.Providers = yamlCfg.AI.Providers
+				}
+				if len(yamlCfg.AI.TokenBudgets) > 0 {
+					cfg.AI.TokenBudgets = yamlCfg.AI.TokenBudgets
+				}
+				if yamlCfg.AI.Timeout != "" {
+					cfg.AI.Timeout = yamlCfg.AI.Timeout
+				}
+				if yamlCfg.AI.Secrets != "" {
+					cfg.AI.Secrets = yamlCfg.AI.Secrets
+				}
+
 				cfg.AI.Enabled = yamlCfg.AI.Enabled
+				cfg.AI.Body = yamlCfg.AI.Body
 
 				if yamlCfg.Performance.PatchBytes > 0 {
 					cfg.Performance.PatchBytes = yamlCfg.Performance.PatchBytes
@@ -139,7 +352,25 @@ func loadFromYAML(cfg Config) Config {
 				if yamlCfg.Performance.CacheTTL != "" {
 					cfg.Performance.CacheTTL = yamlCfg.Performance.CacheTTL
 				}
+				if yamlCfg.Performance.MaxRetries != nil {
+					cfg.Performance.MaxRetries = yamlCfg.Performance.MaxRetries
+				}
+				if yamlCfg.Performance.RetryBaseDelay != "" {
+					cfg.Performance.RetryBaseDelay = yamlCfg.Performance.RetryBaseDelay
+				}
+				if yamlCfg.Performance.RetryMaxDelay != "" {
+					cfg.Performance.RetryMaxDelay = yamlCfg.Performance.RetryMaxDelay
+				}
+				if yamlCfg.Performance.CacheMaxEntries > 0 {
+					cfg.Performance.CacheMaxEntries = yamlCfg.Performance.CacheMaxEntries
+				}
+				if yamlCfg.Performance.CacheMaxBytes > 0 {
+					cfg.Performance.CacheMaxBytes = yamlCfg.Performance.CacheMaxBytes
+				}
 
+				cfg.Diff = yamlCfg.Diff
+				cfg.Scopes = yamlCfg.Scopes
+				cfg.Types = yamlCfg.Types
 				cfg.Git = yamlCfg.Git
 				cfg.Output = yamlCfg.Output
 				cfg.Advanced = yamlCfg.Advanced
@@ -151,6 +382,124 @@ func loadFromYAML(cfg Config) Config {
 	return cfg
 }
 
+// parentDirs lists dir and the directories above it, without the root,
+// from the outermost in: "a/b" gives "a" and "a/b".
+func parentDirs(dir string) []string {
+	dir = path.Clean(filepath.ToSlash(dir))
+	if dir == "." || dir == "/" {
+		return nil
+	}
+	return append(parentDirs(path.Dir(dir)), dir)
+}
+
+// mergePackage applies the package config in dir, if there is one, to cfg.
+func mergePackage(cfg Config, dir string) Config {
+	for _, name := range packageFiles {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		var pkg Config
+		if err := yaml.Unmarshal(data, &pkg); err != nil {
+			return cfg
+		}
+
+		if pkg.AI.Provider != "" && !strings.EqualFold(pkg.AI.Provider, cfg.AI.Provider) {
+			// Settings for another backend do not carry over
+			cfg.AI.Provider = pkg.AI.Provider
+			cfg.AI.Providers = nil
+			cfg.AI.Model = ""
+			cfg.AI.APIKey = ""
+			cfg.AI.BaseURL = ""
+		}
+		if len(pkg.AI.Providers) > 0 {
+			cfg.AI.Providers = pkg.AI.Providers
+		}
+		if pkg.AI.Model != "" {
+			cfg.AI.Model = pkg.AI.Model
+		}
+		if pkg.AI.BaseURL != "" {
+			cfg.AI.BaseURL = pkg.AI.BaseURL
+		}
+
+		if file := pkg.Advanced.ConventionsFile; file != "" {
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(dir, file)
+			}
+			cfg.Advanced.ConventionsFile = file
+		}
+		if len(pkg.Types) > 0 {
+			cfg.Types = pkg.Types
+		}
+		if len(pkg.Scopes) > 0 {
+			scopes := make(map[string]string, len(cfg.Scopes)+len(pkg.Scopes))
+			for glob, name := range cfg.Scopes {
+				scopes[glob] = name
+			}
+			for glob, name := range pkg.Scopes {
+				scopes[rebaseGlob(dir, glob)] = name
+			}
+			cfg.Scopes = scopes
+		}
+		return cfg
+	}
+	return cfg
+}
+
+// rebaseGlob turns a glob from a package config, which like a .gitignore
+// is relative to its directory, into one relative to the repository root.
+func rebaseGlob(dir, glob string) string {
+	dir = filepath.ToSlash(dir)
+	if strings.Contains(strings.TrimSuffix(glob, "/"), "/") {
+		return dir + "/" + strings.TrimPrefix(glob, "/")
+	}
+	return dir + "/**/" + glob
+}
+
+// Package is a directory of a monorepo with its own commitgen.yaml, and
+// the changed files below it.
+type Package struct {
+	Dir   string
+	Files []string
+}
+
+// Packages groups paths, relative to the repository root, by the nearest
+// directory below the root that has a package config. Paths outside any
+// package are left out.
+func Packages(paths []string) []Package {
+	hasConfig := map[string]bool{}
+	isPackage := func(dir string) bool {
+		found, seen := hasConfig[dir]
+		if !seen {
+			for _, name := range packageFiles {
+				if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+					found = true
+					break
+				}
+			}
+			hasConfig[dir] = found
+		}
+		return found
+	}
+
+	byDir := map[string][]string{}
+	for _, p := range paths {
+		for dir := path.Dir(p); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if isPackage(dir) {
+				byDir[dir] = append(byDir[dir], p)
+				break
+			}
+		}
+	}
+
+	packages := make([]Package, 0, len(byDir))
+	for dir, files := range byDir {
+		packages = append(packages, Package{Dir: dir, Files: files})
+	}
+	sort.Slice(packages, func(i, j int) bool { return packages[i].Dir < packages[j].Dir })
+	return packages
+}
+
 func loadEnvFiles() {
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -184,6 +533,16 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func parseDuration(value string, defaultValue time.Duration) time.Duration {
+	if value == "" {
+		return defaultValue
+	}
+	if parsed, err := time.ParseDuration(value); err == nil {
+		return parsed
+	}
+	return defaultValue
+}
+
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if parsed, err := strconv.ParseBool(value); err == nil {
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/joaquinalmora/commitgen/internal/cache"
+	"github.com/joaquinalmora/commitgen/internal/provider"
+)
+
+// inRepo runs the test from a temporary repository root holding files, with
+// a home directory and environment that cannot leak into the result.
+func inRepo(t *testing.T, files map[string]string) {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("HOME", t.TempDir())
+	for _, key := range []string{"COMMITGEN_PROVIDER", "COMMITGEN_PROVIDERS", "COMMITGEN_MODEL", "COMMITGEN_BASE_URL", "OPENAI_API_KEY", "ANTHROPIC_API_KEY"} {
+		t.Setenv(key, "")
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+}
+
+func TestLoadForMergesPackageConfigs(t *testing.T) {
+	inRepo(t, map[string]string{
+		"commitgen.yaml": `ai:
+  provider: openai
+  model: gpt-4o
+types: [feat, fix, chore]
+scopes:
+  "docs/": docs
+`,
+		"services/commitgen.yaml": `types: [feat, fix]
+`,
+		"services/api/commitgen.yml": `ai:
+  provider: anthropic
+advanced:
+  conventions_file: conventions.md
+scopes:
+  "handlers/": handlers
+  "/cmd/": cmd
+  "*.proto": proto
+`,
+	})
+
+	cfg := LoadFor("services/api")
+	if cfg.AI.Provider != "anthropic" || cfg.AI.Model == "gpt-4o" {
+		t.Errorf("expected the package's provider without the root model, got %s/%s", cfg.AI.Provider, cfg.AI.Model)
+	}
+	if !reflect.DeepEqual(cfg.Types, []string{"feat", "fix"}) {
+		t.Errorf("expected the nearest types, got %v", cfg.Types)
+	}
+	if cfg.Advanced.ConventionsFile != filepath.Join("services/api", "conventions.md") {
+		t.Errorf("conventions file should be relative to the package, got %q", cfg.Advanced.ConventionsFile)
+	}
+	want := map[string]string{
+		"docs/":                     "docs",
+		"services/api/**/handlers/": "handlers",
+		"services/api/cmd/":         "cmd",
+		"services/api/**/*.proto":   "proto",
+	}
+	if !reflect.DeepEqual(cfg.Scopes, want) {
+		t.Errorf("unexpected scopes %v", cfg.Scopes)
+	}
+
+	root := Load()
+	if root.AI.Provider != "openai" || root.AI.Model != "gpt-4o" || len(root.Types) != 3 {
+		t.Errorf("the root config should not see package settings, got %+v", root.AI)
+	}
+}
+
+func TestPackages(t *testing.T) {
+	inRepo(t, map[string]string{
+		"commitgen.yaml":              "",
+		"services/api/commitgen.yaml": "",
+		"services/web/commitgen.yml":  "",
+	})
+
+	got := Packages([]string{"services/api/main.go", "README.md", "services/web/app/index.ts", "services/api/go.mod", "services/shared/x.go"})
+	want := []Package{
+		{Dir: "services/api", Files: []string{"services/api/main.go", "services/api/go.mod"}},
+		{Dir: "services/web", Files: []string{"services/web/app/index.ts"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Packages() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCacheOptions(t *testing.T) {
+	inRepo(t, map[string]string{
+		"commitgen.yaml": `ai:
+  provider: anthropic
+  model: claude-test
+  body: true
+types: [feat, fix]
+performance:
+  cache_ttl: "2h"
+  cache_max_entries: 50
+`,
+	})
+
+	got := Load().CacheOptions()
+	if got.TTL != 2*time.Hour || got.MaxEntries != 50 || got.MaxBytes != 0 {
+		t.Errorf("CacheOptions() limits = %+v", got)
+	}
+	want := cache.Settings{
+		Providers:   []string{"anthropic:claude-test"},
+		Conventions: provider.ConventionsHash(""),
+		Prompt:      provider.PromptVersion,
+		Body:        true,
+		Types:       []string{"feat", "fix"},
+	}
+	if !reflect.DeepEqual(got.Settings, want) {
+		t.Errorf("CacheOptions().Settings = %+v, want %+v", got.Settings, want)
+	}
+
+	var cfg Config
+	cfg.Performance.CacheTTL = "a day"
+	if got := cfg.CacheOptions().TTL; got != cache.DefaultOptions.TTL {
+		t.Errorf("invalid cache_ttl gave %s, want the default", got)
+	}
+}
@@ -1,47 +1,226 @@
 package diff
 
 import (
+	"fmt"
+	"io"
+	"os"
 	"os/exec"
 	"strings"
 )
 
-func StagedFiles() ([]string, error) {
-	changedFilesBytes, err := exec.Command("git", "diff", "--cached", "--name-only").Output()
+// Source selects which changes to read. The zero value is the index, as
+// compared with HEAD; at most one field should be set.
+type Source struct {
+	// Rev is a commit, compared with its first parent
+	Rev string
+	// Range is a span such as "A..B" or "A...B", as understood by git diff
+	Range string
+	// Worktree selects unstaged changes in the working tree
+	Worktree bool
+	// Amend selects what git commit --amend would record: the index
+	// compared with HEAD's first parent
+	Amend bool
+}
+
+// String describes the source for messages, e.g. "staged changes".
+func (s Source) String() string {
+	switch {
+	case s.Rev != "":
+		return "commit " + s.Rev
+	case s.Range != "":
+		return "range " + s.Range
+	case s.Worktree:
+		return "unstaged changes"
+	case s.Amend:
+		return "amended commit"
+	default:
+		return "staged changes"
+	}
+}
+
+// args returns the git diff arguments that select the source's changes.
+func (s Source) args() ([]string, error) {
+	switch {
+	case s.Rev != "":
+		base, err := parentOf(s.Rev)
+		if err != nil {
+			return nil, err
+		}
+		return []string{base, s.Rev}, nil
+	case s.Range != "":
+		return []string{s.Range}, nil
+	case s.Worktree:
+		return nil, nil
+	case s.Amend:
+		base, err := parentOf("HEAD")
+		if err != nil {
+			return nil, err
+		}
+		return []string{"--cached", base}, nil
+	default:
+		return []string{"--cached"}, nil
+	}
+}
+
+// parentOf returns rev's first parent, or the empty tree for a root
+// commit.
+func parentOf(rev string) (string, error) {
+	out, err := exec.Command("git", "rev-list", "--parents", "-n", "1", rev, "--").Output()
 	if err != nil {
-		return nil, err
+		return "", fmt.Errorf("unknown revision %q", rev)
+	}
+	ids := strings.Fields(string(out))
+	if len(ids) > 1 {
+		return ids[1], nil
+	}
+
+	// Hashing an empty tree works for SHA-1 and SHA-256 repositories alike
+	cmd := exec.Command("git", "hash-object", "-t", "tree", "--stdin")
+	cmd.Stdin = strings.NewReader("")
+	out, err = cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ReadFile returns the contents of path before or after the source's
+// changes: from a commit, the index or the working tree as appropriate. A
+// file that does not exist on that side is an error.
+func (s Source) ReadFile(path string, after bool) ([]byte, error) {
+	switch {
+	case s.Rev != "":
+		if after {
+			return showBlob(s.Rev, path)
+		}
+		base, err := parentOf(s.Rev)
+		if err != nil {
+			return nil, err
+		}
+		return showBlob(base, path)
+	case s.Range != "":
+		from, to, err := s.rangeEnds()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case !after:
+			return showBlob(from, path)
+		case to == "":
+			return os.ReadFile(path)
+		default:
+			return showBlob(to, path)
+		}
+	case s.Worktree:
+		if after {
+			return os.ReadFile(path)
+		}
+		return showBlob("", path)
+	case s.Amend:
+		if after {
+			return showBlob("", path)
+		}
+		base, err := parentOf("HEAD")
+		if err != nil {
+			return nil, err
+		}
+		return showBlob(base, path)
+	default:
+		if after {
+			return showBlob("", path)
+		}
+		return showBlob("HEAD", path)
 	}
+}
 
-	rawFiles := strings.Split(strings.TrimSpace(string(changedFilesBytes)), "\n")
+// rangeEnds resolves Range the way git diff does: "A..B" compares A with
+// B, "A...B" the merge base of A and B with B, and a missing end means
+// HEAD. A single revision is compared with the working tree, reported as an
+// empty to.
+func (s Source) rangeEnds() (from, to string, err error) {
+	orHead := func(rev string) string {
+		if rev == "" {
+			return "HEAD"
+		}
+		return rev
+	}
 
-	var files []string
-	for _, f := range rawFiles {
-		if f != "" {
-			files = append(files, f)
+	if a, b, ok := strings.Cut(s.Range, "..."); ok {
+		out, err := exec.Command("git", "merge-base", orHead(a), orHead(b)).Output()
+		if err != nil {
+			return "", "", fmt.Errorf("no merge base for %q", s.Range)
 		}
+		return strings.TrimSpace(string(out)), orHead(b), nil
+	}
+	if a, b, ok := strings.Cut(s.Range, ".."); ok {
+		return orHead(a), orHead(b), nil
 	}
+	return s.Range, "", nil
+}
+
+// showBlob reads path at rev, or from the index when rev is empty.
+func showBlob(rev, path string) ([]byte, error) {
+	return exec.Command("git", "cat-file", "blob", rev+":"+path).Output()
+}
 
-	return files, nil
+// Staged parses the staged changes. Files that filter excludes or that
+// look generated are listed without hunks, and what remains of the patch is
+// cut to at most filesLimitBytes; statuses and line counts always cover
+// every file.
+func Staged(filesLimitBytes int, filter *Filter) (*Diff, error) {
+	return Read(Source{}, filesLimitBytes, filter)
 }
 
-func StagedChanges(filesLimitBytes int) (files []string, patch string, err error) {
-	files, err = StagedFiles()
+// Read parses the changes selected by src the same way Staged does.
+func Read(src Source, filesLimitBytes int, filter *Filter) (*Diff, error) {
+	args, err := src.args()
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := gitDiff(args, "--raw", "--numstat", "-z")
 	if err != nil {
-		return nil, "", err
+		return nil, err
+	}
+	if len(raw) == 0 {
+		return &Diff{}, nil
 	}
 
-	if len(files) == 0 {
-		return files, "", nil
+	patch, err := gitDiff(args, "--unified=3")
+	if err != nil {
+		return nil, err
 	}
 
-	stagedChangesBytes, err := exec.Command("git", "diff", "--cached", "--unified=3").Output()
+	changes, err := Parse(raw, string(patch))
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
+	changes.Exclude(filter)
+	changes.Truncate(filesLimitBytes)
+	return changes, nil
+}
+
+// gitDiff runs git diff with flags before the revision arguments, and
+// reports git's own message when it fails.
+func gitDiff(args []string, flags ...string) ([]byte, error) {
+	cmdArgs := append(append([]string{"diff"}, flags...), args...)
+	out, err := exec.Command("git", append(cmdArgs, "--")...).Output()
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return nil, fmt.Errorf("%s", strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return out, err
+}
 
-	patch = string(stagedChangesBytes)
-	if len(patch) > filesLimitBytes {
-		patch = patch[:filesLimitBytes]
+// ReadPatch parses a unified diff from r, such as the output of git diff or
+// git format-patch, and filters and truncates it like Staged.
+func ReadPatch(r io.Reader, filesLimitBytes int, filter *Filter) (*Diff, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
 	}
 
-	return files, patch, nil
+	changes := FromPatch(nil, string(data))
+	changes.Exclude(filter)
+	changes.Truncate(filesLimitBytes)
+	return changes, nil
 }
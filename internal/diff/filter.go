@@ -0,0 +1,305 @@
+package diff
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// DefaultExcludes lists files whose hunks are rarely worth sending to a
+// model: lockfiles, generated protobuf code, vendored dependencies,
+// snapshots and minified assets.
+var DefaultExcludes = []string{
+	"go.sum",
+	"go.work.sum",
+	"package-lock.json",
+	"npm-shrinkwrap.json",
+	"yarn.lock",
+	"pnpm-lock.yaml",
+	"bun.lockb",
+	"Cargo.lock",
+	"Gemfile.lock",
+	"composer.lock",
+	"poetry.lock",
+	"Pipfile.lock",
+	"uv.lock",
+	"mix.lock",
+	"pubspec.lock",
+	"Podfile.lock",
+	"flake.lock",
+	"*.pb.go",
+	"*.pb.gw.go",
+	"*_pb2.py",
+	"*_pb2_grpc.py",
+	"*.pb.cc",
+	"*.pb.h",
+	"vendor/",
+	"node_modules/",
+	"__snapshots__/",
+	"*.snap",
+	"*.min.js",
+	"*.min.css",
+}
+
+// Omitted reasons recorded on File.Omitted.
+const (
+	OmittedExcluded  = "excluded"
+	OmittedGenerated = "generated"
+)
+
+// generatedMarker matches the "Code generated ... DO NOT EDIT." convention
+// from https://go.dev/s/generatedcode in any common comment style, and the
+// "@generated" tag used by many other code generators.
+var generatedMarker = regexp.MustCompile(`^\s*(?://|#|--|;|/?\*+)\s*(?:Code generated .* DO NOT EDIT\.?|@generated\b)`)
+
+// markerLines is how far into a file a generated-code marker is looked for.
+const markerLines = 20
+
+// Filter decides which files are excluded from the prompt. Patterns use
+// .gitignore syntax and later patterns override earlier ones, so a "!"
+// pattern can bring back a file that a default excludes.
+type Filter struct {
+	rules []rule
+}
+
+type rule struct {
+	negate  bool
+	dirOnly bool
+	re      *regexp.Regexp
+}
+
+// NewFilter compiles patterns written in .gitignore syntax. Blank lines and
+// comments are skipped.
+func NewFilter(patterns []string) *Filter {
+	f := &Filter{}
+	for _, p := range patterns {
+		if r, ok := parseRule(p); ok {
+			f.rules = append(f.rules, r)
+		}
+	}
+	return f
+}
+
+// LoadFilter builds the filter used for staged changes: DefaultExcludes,
+// then the patterns in ignoreFile if it exists, then exclude, then include
+// as negated patterns so that it wins over everything else.
+func LoadFilter(ignoreFile string, exclude, include []string) (*Filter, error) {
+	patterns := append([]string{}, DefaultExcludes...)
+
+	file, err := os.Open(ignoreFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			patterns = append(patterns, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	patterns = append(patterns, exclude...)
+	for _, p := range include {
+		patterns = append(patterns, "!"+strings.TrimPrefix(p, "!"))
+	}
+	return NewFilter(patterns), nil
+}
+
+// Excludes reports whether path, relative to the repository root, is
+// excluded.
+func (f *Filter) Excludes(path string) bool {
+	excluded, _ := f.match(path)
+	return excluded
+}
+
+// match returns the verdict of the last pattern matching path, and whether
+// any pattern matched at all.
+func (f *Filter) match(path string) (excluded, matched bool) {
+	if f == nil {
+		return false, false
+	}
+	path = strings.TrimPrefix(path, "/")
+
+	for _, r := range f.rules {
+		if r.matches(path) {
+			excluded, matched = !r.negate, true
+		}
+	}
+	return excluded, matched
+}
+
+// matches checks path and each of its parent directories, so that "vendor/"
+// covers everything below a vendor directory.
+func (r rule) matches(path string) bool {
+	if !r.dirOnly && r.re.MatchString(path) {
+		return true
+	}
+	for i := 0; i < len(path); i++ {
+		if path[i] == '/' && r.re.MatchString(path[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseRule(line string) (rule, bool) {
+	// Trailing spaces are ignored unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule{}, false
+	}
+
+	var r rule
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule{}, false
+	}
+
+	// A slash anywhere but the end anchors the pattern to the root
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := globToRegexp(line)
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return rule{}, false
+	}
+	r.re = re
+	return r, true
+}
+
+// globToRegexp translates one .gitignore pattern, with "**" matching any
+// number of directories.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// Exclude leaves out the hunks of files that f excludes, and of files that
+// carry a generated-code marker near the top unless a pattern explicitly
+// includes them. Excluded files keep their header, status and line counts,
+// and Patch is rebuilt from what remains.
+func (d *Diff) Exclude(f *Filter) {
+	var patch strings.Builder
+	for i := range d.Files {
+		file := &d.Files[i]
+		excluded, matched := f.match(file.Path)
+		switch {
+		case excluded:
+			file.Omitted = OmittedExcluded
+		case !matched && isGenerated(*file):
+			file.Omitted = OmittedGenerated
+		}
+		if file.Omitted != "" {
+			file.Hunks = nil
+		}
+		patch.WriteString(file.String())
+	}
+	d.Patch = patch.String()
+}
+
+// isGenerated looks for a generated-code marker in the first lines of
+// either side of the file, as far as the hunks show them.
+func isGenerated(f File) bool {
+	for _, h := range f.Hunks {
+		oldLine, newLine := h.OldStart, h.NewStart
+		lines := strings.Split(h.Text, "\n")
+		for _, line := range lines[1:] {
+			if oldLine > markerLines && newLine > markerLines {
+				break
+			}
+			if line == "" || line[0] == '\\' {
+				continue
+			}
+			if generatedMarker.MatchString(line[1:]) {
+				return true
+			}
+			switch line[0] {
+			case '+':
+				newLine++
+			case '-':
+				oldLine++
+			default:
+				oldLine++
+				newLine++
+			}
+		}
+	}
+	return false
+}
+
+// Truncate cuts Patch to at most limit bytes and re-reads headers and
+// hunks from what is left. Files past the cut keep their status and line
+// counts but lose their header and hunks.
+func (d *Diff) Truncate(limit int) {
+	patch := Truncate(d.Patch, limit)
+	if len(patch) == len(d.Patch) {
+		return
+	}
+
+	// Patch is the files' sections in order, so the n-th section of the
+	// cut patch belongs to the n-th file with a header
+	sections := splitPatch(patch)
+	n := 0
+	for i := range d.Files {
+		f := &d.Files[i]
+		if f.Header == "" {
+			continue
+		}
+		if n < len(sections) {
+			f.Header, f.Hunks = sections[n].Header, sections[n].Hunks
+		} else {
+			f.Header, f.Hunks = "", nil
+		}
+		n++
+	}
+	d.Patch = patch
+}
@@ -0,0 +1,153 @@
+package diff
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFilterExcludes(t *testing.T) {
+	f := NewFilter(append(append([]string{}, DefaultExcludes...),
+		"# comment",
+		"",
+		"/build/",
+		"docs/**/*.png",
+		"*.log",
+		"!keep.log",
+		`\#hash`,
+		"gen/[a-c]?.go",
+		"!vendor/patched/",
+	))
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"go.sum", true},
+		{"tools/go.sum", true},
+		{"go.mod", false},
+		{"web/package-lock.json", true},
+		{"api/v1/user.pb.go", true},
+		{"api/v1/user.go", false},
+		{"vendor/github.com/x/y.go", true},
+		{"vendor/patched/z.go", false},
+		{"ui/__snapshots__/App.test.js.snap", true},
+		{"build/out.js", true},
+		{"src/build/out.js", false},
+		{"docs/a/b/diagram.png", true},
+		{"docs/diagram.png", true},
+		{"img/diagram.png", false},
+		{"logs/app.log", true},
+		{"keep.log", false},
+		{"#hash", true},
+		{"gen/ab.go", true},
+		{"gen/zb.go", false},
+		{"vendor.go", false},
+	}
+	for _, tt := range tests {
+		if got := f.Excludes(tt.path); got != tt.want {
+			t.Errorf("Excludes(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestLoadFilter(t *testing.T) {
+	ignore := filepath.Join(t.TempDir(), ".commitgenignore")
+	if err := os.WriteFile(ignore, []byte("testdata/\n*.golden\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := LoadFilter(ignore, []string{"*.csv"}, []string{"go.sum", "testdata/keep.golden"})
+	if err != nil {
+		t.Fatalf("LoadFilter: %v", err)
+	}
+	for path, want := range map[string]bool{
+		"testdata/in.txt":      true,
+		"x.golden":             true,
+		"data.csv":             true,
+		"go.sum":               false,
+		"testdata/keep.golden": false,
+		"yarn.lock":            true,
+	} {
+		if got := f.Excludes(path); got != want {
+			t.Errorf("Excludes(%q) = %v, want %v", path, got, want)
+		}
+	}
+
+	if _, err := LoadFilter(filepath.Join(t.TempDir(), "missing"), nil, nil); err != nil {
+		t.Errorf("a missing ignore file should not be an error: %v", err)
+	}
+}
+
+const filterPatch = `diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1 +1,2 @@
+ package main
++// real change
+diff --git a/go.sum b/go.sum
+--- a/go.sum
++++ b/go.sum
+@@ -1 +1,2 @@
+ a v1 h1:x
++b v1 h1:y
+diff --git a/api/types.go b/api/types.go
+new file mode 100644
+--- /dev/null
++++ b/api/types.go
+@@ -0,0 +1,3 @@
++// Code generated by protoc-gen-go. DO NOT EDIT.
++
++package api
+`
+
+func TestExclude(t *testing.T) {
+	d := FromPatch(nil, filterPatch)
+	d.Exclude(NewFilter(DefaultExcludes))
+
+	if d.Files[0].Omitted != "" || len(d.Files[0].Hunks) != 1 {
+		t.Errorf("main.go should be kept: %+v", d.Files[0])
+	}
+	sum := d.Files[1]
+	if sum.Omitted != OmittedExcluded || len(sum.Hunks) != 0 || sum.Added != 1 {
+		t.Errorf("go.sum should keep its stats but lose its hunks: %+v", sum)
+	}
+	if got := sum.Describe(); got != "go.sum (modified, +1 -0, excluded)" {
+		t.Errorf("unexpected description %q", got)
+	}
+	if d.Files[2].Omitted != OmittedGenerated {
+		t.Errorf("expected generated file to be detected: %+v", d.Files[2])
+	}
+
+	if strings.Contains(d.Patch, "h1:y") || strings.Contains(d.Patch, "protoc-gen-go") {
+		t.Errorf("omitted hunks are still in the patch:\n%s", d.Patch)
+	}
+	if !strings.Contains(d.Patch, "diff --git a/go.sum b/go.sum") || !strings.Contains(d.Patch, "+// real change") {
+		t.Errorf("expected headers and kept hunks in the patch:\n%s", d.Patch)
+	}
+
+	// An explicit include wins over the generated marker
+	d = FromPatch(nil, filterPatch)
+	d.Exclude(NewFilter([]string{"!api/types.go"}))
+	if d.Files[2].Omitted != "" {
+		t.Errorf("explicitly included file was omitted: %+v", d.Files[2])
+	}
+}
+
+func TestDiffTruncate(t *testing.T) {
+	d := FromPatch(nil, filterPatch)
+	d.Exclude(nil)
+	limit := strings.Index(d.Patch, "diff --git a/api/types.go")
+	d.Truncate(limit + 20)
+
+	if d.Patch != filterPatch[:limit] {
+		t.Fatalf("unexpected patch after truncation:\n%s", d.Patch)
+	}
+	if len(d.Files[1].Hunks) != 1 {
+		t.Errorf("go.sum hunk should survive the cut: %+v", d.Files[1])
+	}
+	if last := d.Files[2]; last.Header != "" || last.Hunks != nil || last.Added != 3 {
+		t.Errorf("file past the cut should keep only its stats: %+v", last)
+	}
+}
@@ -0,0 +1,210 @@
+package diff
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Status is how a file changed, following the letters of git diff --raw.
+type Status string
+
+const (
+	StatusAdded       Status = "added"
+	StatusModified    Status = "modified"
+	StatusDeleted     Status = "deleted"
+	StatusRenamed     Status = "renamed"
+	StatusCopied      Status = "copied"
+	StatusModeChanged Status = "mode changed"
+	StatusTypeChanged Status = "type changed"
+	StatusUnmerged    Status = "unmerged"
+)
+
+// Diff is a parsed set of changes.
+type Diff struct {
+	Files []File
+	// Patch is the unified diff the hunks were read from, possibly
+	// truncated.
+	Patch string
+	// API lists changes to exported declarations, when a language analyzer
+	// has looked at the files.
+	API []APIChange
+	// Scope is the conventional-commit scope inferred for the changes, or
+	// empty when they span several areas.
+	Scope string
+}
+
+// APIKind is how an exported declaration changed.
+type APIKind string
+
+const (
+	APIAdded   APIKind = "added"
+	APIRemoved APIKind = "removed"
+	APIChanged APIKind = "changed"
+)
+
+// APIChange is one exported declaration that was added, removed or changed,
+// e.g. the method Cache.Delete in package cache.
+type APIChange struct {
+	Kind APIKind
+	// Decl is "func", "method", "type" or "field".
+	Decl    string
+	Package string
+	// Name is qualified by its type for methods and fields, e.g.
+	// "Cache.Delete".
+	Name string
+	// Path is the file declaring it, before the change for removals.
+	Path string
+	// Before and After are the signatures or types on either side, empty
+	// where the declaration does not exist.
+	Before, After string
+	// Breaking is set for removals and signature changes, which may break
+	// callers.
+	Breaking bool
+}
+
+// String describes the change on one line, e.g. "changed func Load:
+// func(string) error -> func(string, Options) error (potentially breaking)".
+func (c APIChange) String() string {
+	s := string(c.Kind) + " " + c.Decl + " " + c.Name
+	if c.Package != "" {
+		s += " in package " + c.Package
+	}
+	if c.Kind == APIChanged {
+		s += ": " + c.Before + " -> " + c.After
+	}
+	if c.Breaking {
+		s += " (potentially breaking)"
+	}
+	return s
+}
+
+// File is one changed file.
+type File struct {
+	// Path is the file's path after the change, or before it for deletions.
+	Path    string
+	OldPath string
+	Status  Status
+	// Similarity is the rename or copy score in percent.
+	Similarity int
+	OldMode    string
+	NewMode    string
+	Binary     bool
+	// Added and Removed count changed lines over the whole file, even when
+	// the patch was truncated.
+	Added   int
+	Removed int
+	// Omitted says why the file's hunks were left out of the patch, e.g.
+	// OmittedExcluded; empty when they were not.
+	Omitted string
+
+	// Header holds the "diff --git" line and the index, mode and ---/+++
+	// lines that precede the first hunk.
+	Header string
+	Hunks  []Hunk
+}
+
+// Hunk is one "@@" section of a file's patch.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	// Context is the function or section heading git prints after the
+	// second "@@", if any.
+	Context string
+	Added   int
+	Removed int
+	// Text is the hunk as it appears in the patch, "@@" line included.
+	Text string
+}
+
+// Paths returns the path of every changed file, in diff order.
+func (d *Diff) Paths() []string {
+	paths := make([]string, len(d.Files))
+	for i, f := range d.Files {
+		paths[i] = f.Path
+	}
+	return paths
+}
+
+// Select returns the part of the changes that touches the given paths, with
+// the patch and API changes cut down to match. The scope is not carried
+// over, since it was inferred for every file.
+func (d *Diff) Select(paths []string) *Diff {
+	keep := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		keep[p] = true
+	}
+
+	out := &Diff{}
+	var patch strings.Builder
+	for _, f := range d.Files {
+		if keep[f.Path] {
+			out.Files = append(out.Files, f)
+			patch.WriteString(f.String())
+		}
+	}
+	out.Patch = patch.String()
+	for _, c := range d.API {
+		if keep[c.Path] {
+			out.API = append(out.API, c)
+		}
+	}
+	return out
+}
+
+// Stats returns the total number of added and removed lines.
+func (d *Diff) Stats() (added, removed int) {
+	for _, f := range d.Files {
+		added += f.Added
+		removed += f.Removed
+	}
+	return added, removed
+}
+
+// Empty reports whether there are no changes at all.
+func (d *Diff) Empty() bool {
+	return d == nil || len(d.Files) == 0
+}
+
+// String reassembles the file's part of the patch.
+func (f File) String() string {
+	var b strings.Builder
+	b.WriteString(f.Header)
+	for _, h := range f.Hunks {
+		b.WriteString(h.Text)
+	}
+	return b.String()
+}
+
+// Describe summarises the file on one line, e.g. "old.go -> new.go
+// (renamed 95%, +3 -1)".
+func (f File) Describe() string {
+	var b strings.Builder
+	if f.OldPath != "" && f.OldPath != f.Path {
+		b.WriteString(f.OldPath + " -> ")
+	}
+	b.WriteString(f.Path)
+	b.WriteString(" (" + string(f.Status))
+	if f.Similarity > 0 && (f.Status == StatusRenamed || f.Status == StatusCopied) {
+		b.WriteString(" " + strconv.Itoa(f.Similarity) + "%")
+	}
+	switch {
+	case f.Binary:
+		b.WriteString(", binary")
+	case f.Added > 0 || f.Removed > 0:
+		b.WriteString(", +" + strconv.Itoa(f.Added) + " -" + strconv.Itoa(f.Removed))
+	}
+	if f.Status != StatusModeChanged && f.ModeChanged() {
+		b.WriteString(", mode " + f.OldMode + " -> " + f.NewMode)
+	}
+	if f.Omitted != "" {
+		b.WriteString(", " + f.Omitted)
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// ModeChanged reports whether the file's mode differs before and after.
+func (f File) ModeChanged() bool {
+	return f.OldMode != "" && f.NewMode != "" && f.OldMode != f.NewMode &&
+		f.Status != StatusAdded && f.Status != StatusDeleted
+}
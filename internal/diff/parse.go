@@ -0,0 +1,330 @@
+package diff
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FromPatch builds a Diff from a unified diff alone, reading statuses and
+// line counts from the patch. Paths in files that the patch does not
+// mention are added as modified files without hunks.
+func FromPatch(files []string, patch string) *Diff {
+	d := &Diff{Files: splitPatch(patch), Patch: patch}
+	for i := range d.Files {
+		f := &d.Files[i]
+		describeFromHeader(f)
+		for _, h := range f.Hunks {
+			f.Added += h.Added
+			f.Removed += h.Removed
+		}
+	}
+
+	seen := make(map[string]bool, len(d.Files))
+	for _, f := range d.Files {
+		seen[f.Path] = true
+	}
+	for _, path := range files {
+		if !seen[path] {
+			d.Files = append(d.Files, File{Path: path, Status: StatusModified})
+			seen[path] = true
+		}
+	}
+	return d
+}
+
+// Parse combines the output of "git diff --raw --numstat -z" with the
+// matching patch. Statuses, paths and line counts come from raw and numstat,
+// which stay accurate when the patch has been truncated; headers and hunks
+// come from the patch.
+func Parse(rawNumstat []byte, patch string) (*Diff, error) {
+	files, err := parseRawNumstat(string(rawNumstat))
+	if err != nil {
+		return nil, err
+	}
+
+	sections := splitPatch(patch)
+	byPath := make(map[string]File, len(sections))
+	for _, s := range sections {
+		byPath[s.Path] = s
+	}
+	for i := range files {
+		var s File
+		if len(sections) == len(files) {
+			// Same diff queue, same order; this also copes with quoted paths
+			s = sections[i]
+		} else {
+			s = byPath[files[i].Path]
+		}
+		files[i].Header = s.Header
+		files[i].Hunks = s.Hunks
+	}
+
+	return &Diff{Files: files, Patch: patch}, nil
+}
+
+// parseRawNumstat reads NUL-separated --raw records followed by --numstat
+// records for the same files in the same order.
+func parseRawNumstat(out string) ([]File, error) {
+	fields := strings.Split(out, "\x00")
+	var files []File
+	numstat := 0
+
+	for i := 0; i < len(fields); i++ {
+		field := strings.TrimLeft(fields[i], "\n")
+		if field == "" {
+			continue
+		}
+
+		if strings.HasPrefix(field, ":") {
+			// :old_mode new_mode old_sha new_sha status NUL path [NUL path]
+			meta := strings.Fields(field[1:])
+			if len(meta) < 5 || i+1 >= len(fields) {
+				return nil, fmt.Errorf("malformed raw diff record %q", field)
+			}
+			f := File{OldMode: meta[0], NewMode: meta[1]}
+			letter := meta[4][:1]
+			f.Similarity, _ = strconv.Atoi(meta[4][1:])
+
+			i++
+			f.Path = fields[i]
+			if letter == "R" || letter == "C" {
+				if i+1 >= len(fields) {
+					return nil, fmt.Errorf("malformed raw diff record %q", field)
+				}
+				f.OldPath = f.Path
+				i++
+				f.Path = fields[i]
+			}
+			f.Status = statusFromLetter(letter)
+			if f.Status == StatusModified && f.ModeChanged() && f.OldPath == "" {
+				f.Status = StatusModeChanged
+			}
+			files = append(files, f)
+			continue
+		}
+
+		// added TAB removed TAB path, or an empty path followed by the
+		// old and new paths of a rename or copy
+		parts := strings.SplitN(field, "\t", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("malformed numstat record %q", field)
+		}
+		if parts[2] == "" {
+			i += 2
+		}
+		if numstat >= len(files) {
+			return nil, fmt.Errorf("numstat record without raw record %q", field)
+		}
+		f := &files[numstat]
+		numstat++
+		if parts[0] == "-" && parts[1] == "-" {
+			f.Binary = true
+			continue
+		}
+		f.Added, _ = strconv.Atoi(parts[0])
+		f.Removed, _ = strconv.Atoi(parts[1])
+		if f.Status == StatusModeChanged && (f.Added > 0 || f.Removed > 0) {
+			f.Status = StatusModified
+		}
+	}
+
+	return files, nil
+}
+
+func statusFromLetter(letter string) Status {
+	switch letter {
+	case "A":
+		return StatusAdded
+	case "D":
+		return StatusDeleted
+	case "R":
+		return StatusRenamed
+	case "C":
+		return StatusCopied
+	case "T":
+		return StatusTypeChanged
+	case "U":
+		return StatusUnmerged
+	default:
+		return StatusModified
+	}
+}
+
+// describeFromHeader fills in status, paths, modes and the binary flag
+// from the extended header lines of a git patch.
+func describeFromHeader(f *File) {
+	f.Status = StatusModified
+	for _, line := range strings.Split(f.Header, "\n") {
+		switch {
+		case strings.HasPrefix(line, "new file mode "):
+			f.Status = StatusAdded
+			f.NewMode = strings.TrimPrefix(line, "new file mode ")
+		case strings.HasPrefix(line, "deleted file mode "):
+			f.Status = StatusDeleted
+			f.OldMode = strings.TrimPrefix(line, "deleted file mode ")
+		case strings.HasPrefix(line, "old mode "):
+			f.OldMode = strings.TrimPrefix(line, "old mode ")
+		case strings.HasPrefix(line, "new mode "):
+			f.NewMode = strings.TrimPrefix(line, "new mode ")
+		case strings.HasPrefix(line, "rename from "):
+			f.Status = StatusRenamed
+			f.OldPath = strings.TrimPrefix(line, "rename from ")
+		case strings.HasPrefix(line, "copy from "):
+			f.Status = StatusCopied
+			f.OldPath = strings.TrimPrefix(line, "copy from ")
+		case strings.HasPrefix(line, "similarity index "):
+			f.Similarity, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, "similarity index "), "%"))
+		case strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch":
+			f.Binary = true
+		}
+	}
+	if f.Status == StatusModified && len(f.Hunks) == 0 && f.ModeChanged() {
+		f.Status = StatusModeChanged
+	}
+}
+
+// splitPatch breaks a unified diff into per-file sections with Path,
+// Header and Hunks set. Hunk lengths are taken from the "@@" lines, so
+// removed lines that happen to start with "--- " are not mistaken for a new
+// file. Text before the first file header or after a file's last hunk is
+// dropped.
+func splitPatch(patch string) []File {
+	var files []File
+	var current *File
+	var hunk *Hunk
+	oldLeft, newLeft := 0, 0
+
+	for _, line := range strings.SplitAfter(patch, "\n") {
+		if line == "" {
+			continue
+		}
+
+		if hunk != nil && (oldLeft > 0 || newLeft > 0 || line[0] == '\\') && strings.IndexByte(" +-\\\n", line[0]) >= 0 {
+			hunk.Text += line
+			switch line[0] {
+			case '-':
+				oldLeft--
+				hunk.Removed++
+			case '+':
+				newLeft--
+				hunk.Added++
+			case '\\':
+				// "\ No newline at end of file"
+			default:
+				oldLeft--
+				newLeft--
+			}
+			continue
+		}
+
+		isHeader := strings.HasPrefix(line, "diff --git ") || strings.HasPrefix(line, "--- ")
+		if hunk != nil && !isHeader && !strings.HasPrefix(line, "@@") {
+			// Text after the last hunk, such as a format-patch signature or
+			// the mail headers of the next patch, is skipped up to the next
+			// file
+			current, hunk = nil, nil
+			continue
+		}
+
+		// Plain unified diffs start each file at "---" instead of "diff --git"
+		if strings.HasPrefix(line, "diff --git ") || (strings.HasPrefix(line, "--- ") && (current == nil || hunk != nil)) {
+			files = append(files, File{})
+			current = &files[len(files)-1]
+			hunk = nil
+		}
+		if current == nil {
+			continue
+		}
+
+		if strings.HasPrefix(line, "@@") {
+			current.Hunks = append(current.Hunks, parseHunkHeader(line))
+			hunk = &current.Hunks[len(current.Hunks)-1]
+			oldLeft, newLeft = hunk.OldLines, hunk.NewLines
+			continue
+		}
+		current.Header += line
+	}
+
+	for i := range files {
+		files[i].Path = pathFromHeader(files[i].Header)
+	}
+	return files
+}
+
+// parseHunkHeader reads "@@ -a,b +c,d @@ context". An omitted count means
+// one line.
+func parseHunkHeader(line string) Hunk {
+	h := Hunk{Text: line}
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return h
+	}
+	h.OldStart, h.OldLines = parseRange(strings.TrimPrefix(fields[1], "-"))
+	h.NewStart, h.NewLines = parseRange(strings.TrimPrefix(fields[2], "+"))
+	if i := strings.Index(line[2:], "@@"); i >= 0 {
+		h.Context = strings.TrimSpace(line[2+i+2:])
+	}
+	return h
+}
+
+func parseRange(r string) (start, count int) {
+	s, c, found := strings.Cut(r, ",")
+	start, _ = strconv.Atoi(s)
+	if !found {
+		return start, 1
+	}
+	count, _ = strconv.Atoi(c)
+	return start, count
+}
+
+func pathFromHeader(header string) string {
+	var fromGit string
+	for _, line := range strings.Split(header, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++ ") && !strings.HasSuffix(line, "/dev/null"):
+			return strings.TrimPrefix(strings.TrimPrefix(line, "+++ "), "b/")
+		case strings.HasPrefix(line, "--- ") && !strings.HasSuffix(line, "/dev/null") && fromGit == "":
+			fromGit = strings.TrimPrefix(strings.TrimPrefix(line, "--- "), "a/")
+		case strings.HasPrefix(line, "diff --git "):
+			if i := strings.LastIndex(line, " b/"); i >= 0 {
+				fromGit = line[i+3:]
+			}
+		}
+	}
+	return fromGit
+}
+
+// Truncate shortens patch to at most limit bytes. It prefers to cut at a
+// file or hunk boundary, falls back to a line boundary when that would
+// throw away more than half of the allowance, and never splits a UTF-8
+// character.
+func Truncate(patch string, limit int) string {
+	if len(patch) <= limit {
+		return patch
+	}
+	if limit <= 0 {
+		return ""
+	}
+
+	head := patch[:limit]
+	cut := -1
+	for _, marker := range []string{"\ndiff --git ", "\n@@ "} {
+		if i := strings.LastIndex(head, marker); i+1 > cut {
+			cut = i + 1
+		}
+	}
+	if cut > limit/2 {
+		return patch[:cut]
+	}
+
+	if i := strings.LastIndex(head, "\n"); i >= 0 {
+		return patch[:i+1]
+	}
+
+	for limit > 0 && !utf8.RuneStart(patch[limit]) {
+		limit--
+	}
+	return patch[:limit]
+}
@@ -0,0 +1,226 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+const samplePatch = `diff --git a/a.sql b/a.sql
+index 1111111..2222222 100644
+--- a/a.sql
++++ b/a.sql
+@@ -1,2 +1,1 @@
+--- drop the old table
+ SELECT 1;
+@@ -10 +9,2 @@
+ x
++y
+diff --git a/new.txt b/new.txt
+new file mode 100644
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1 @@
++héllo
+`
+
+func TestFromPatch(t *testing.T) {
+	d := FromPatch([]string{"a.sql", "new.txt", "other.go"}, samplePatch)
+	if len(d.Files) != 3 {
+		t.Fatalf("expected 3 files, got %d", len(d.Files))
+	}
+
+	a := d.Files[0]
+	if a.Path != "a.sql" || a.Status != StatusModified || len(a.Hunks) != 2 {
+		t.Errorf("unexpected first file %+v", a)
+	}
+	if !strings.Contains(a.Hunks[0].Text, "--- drop the old table") {
+		t.Errorf("removed line starting with --- was not kept in its hunk: %q", a.Hunks[0].Text)
+	}
+	if a.Hunks[1].OldStart != 10 || a.Hunks[1].OldLines != 1 || a.Hunks[1].NewStart != 9 || a.Hunks[1].NewLines != 2 {
+		t.Errorf("unexpected hunk range %+v", a.Hunks[1])
+	}
+	if a.Added != 1 || a.Removed != 1 {
+		t.Errorf("expected +1 -1, got +%d -%d", a.Added, a.Removed)
+	}
+
+	if n := d.Files[1]; n.Path != "new.txt" || n.Status != StatusAdded || n.NewMode != "100644" {
+		t.Errorf("unexpected second file %+v", n)
+	}
+	if o := d.Files[2]; o.Path != "other.go" || o.Header != "" {
+		t.Errorf("expected a placeholder for a file missing from the patch, got %+v", o)
+	}
+
+	var joined strings.Builder
+	for _, f := range d.Files {
+		joined.WriteString(f.String())
+	}
+	if joined.String() != samplePatch {
+		t.Error("files do not reassemble into the original patch")
+	}
+}
+
+func TestFromPatchPlainUnifiedDiff(t *testing.T) {
+	patch := "--- a/x.go\n+++ b/x.go\n@@ -1 +1 @@ func main() {\n-a\n+b\n--- a/y.go\n+++ b/y.go\n@@ -1 +1 @@\n-c\n+d\n"
+	d := FromPatch(nil, patch)
+	if len(d.Files) != 2 || d.Files[0].Path != "x.go" || d.Files[1].Path != "y.go" {
+		t.Fatalf("unexpected files %+v", d.Files)
+	}
+	if got := d.Files[0].Hunks[0].Context; got != "func main() {" {
+		t.Errorf("unexpected hunk context %q", got)
+	}
+}
+
+// Output of git diff --cached --raw --numstat -z for a binary edit, a
+// deletion, a mode change, a new file and a rename with an edit.
+const sampleRaw = ":100644 100644 88768ef 3e3315e M\x00b.bin\x00" +
+	":100644 000000 587be6b 0000000 D\x00del.txt\x00" +
+	":100644 100755 28ce6a8 28ce6a8 M\x00mode.sh\x00" +
+	":000000 100644 0000000 3e75765 A\x00n.txt\x00" +
+	":100644 100644 0fdf397 f9d9a01 R085\x00a.txt\x00r.txt\x00" +
+	"-\t-\tb.bin\x000\t1\tdel.txt\x000\t0\tmode.sh\x001\t0\tn.txt\x001\t0\t\x00a.txt\x00r.txt\x00"
+
+const sampleRawPatch = `diff --git a/b.bin b/b.bin
+index 88768ef..3e3315e 100644
+Binary files a/b.bin and b/b.bin differ
+diff --git a/del.txt b/del.txt
+deleted file mode 100644
+index 587be6b..0000000
+--- a/del.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-x
+diff --git a/mode.sh b/mode.sh
+old mode 100644
+new mode 100755
+diff --git a/n.txt b/n.txt
+new file mode 100644
+index 0000000..3e75765
+--- /dev/null
++++ b/n.txt
+@@ -0,0 +1 @@
++new
+diff --git a/a.txt b/r.txt
+similarity index 85%
+rename from a.txt
+rename to r.txt
+index 0fdf397..f9d9a01 100644
+--- a/a.txt
++++ b/r.txt
+@@ -4,3 +4,4 @@ c
+ d
+ e
+ f
++g
+`
+
+func TestParse(t *testing.T) {
+	d, err := Parse([]byte(sampleRaw), sampleRawPatch)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	want := []struct {
+		path   string
+		status Status
+	}{
+		{"b.bin", StatusModified},
+		{"del.txt", StatusDeleted},
+		{"mode.sh", StatusModeChanged},
+		{"n.txt", StatusAdded},
+		{"r.txt", StatusRenamed},
+	}
+	if len(d.Files) != len(want) {
+		t.Fatalf("expected %d files, got %d", len(want), len(d.Files))
+	}
+	for i, w := range want {
+		if f := d.Files[i]; f.Path != w.path || f.Status != w.status {
+			t.Errorf("file %d: got %s (%s), want %s (%s)", i, f.Path, f.Status, w.path, w.status)
+		}
+	}
+
+	if !d.Files[0].Binary {
+		t.Error("expected b.bin to be binary")
+	}
+	r := d.Files[4]
+	if r.OldPath != "a.txt" || r.Similarity != 85 || r.Added != 1 || len(r.Hunks) != 1 || r.Hunks[0].Context != "c" {
+		t.Errorf("unexpected rename %+v", r)
+	}
+	if got := r.Describe(); got != "a.txt -> r.txt (renamed 85%, +1 -0)" {
+		t.Errorf("unexpected description %q", got)
+	}
+	if got := d.Files[2].Describe(); got != "mode.sh (mode changed)" {
+		t.Errorf("unexpected description %q", got)
+	}
+
+	// Line counts survive a truncated patch
+	d, err = Parse([]byte(sampleRaw), sampleRawPatch[:strings.Index(sampleRawPatch, "diff --git a/n.txt")])
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if added, removed := d.Stats(); added != 2 || removed != 1 {
+		t.Errorf("expected +2 -1 overall, got +%d -%d", added, removed)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := Truncate(samplePatch, len(samplePatch)); got != samplePatch {
+		t.Error("patch within the limit should be unchanged")
+	}
+
+	// Cuts before the second file rather than inside its header
+	limit := strings.Index(samplePatch, "new file mode")
+	got := Truncate(samplePatch, limit)
+	if !strings.HasSuffix(got, "+y\n") {
+		t.Errorf("expected a cut at the file boundary, got %q", got)
+	}
+
+	// A cut that lands inside a multi-byte character backs off
+	line := "+" + strings.Repeat("é", 10)
+	for limit := 1; limit < len(line); limit++ {
+		if got := Truncate(line, limit); !utf8.ValidString(got) {
+			t.Fatalf("limit %d produced invalid UTF-8 %q", limit, got)
+		}
+	}
+}
+
+const formatPatch = `From 1f2e3d4c5b6a Mon Sep 17 00:00:00 2001
+From: Dev <dev@example.com>
+Date: Mon, 1 Jan 2024 00:00:00 +0000
+Subject: [PATCH] Fix greeting
+
+---
+ hello.txt | 2 +-
+ 1 file changed, 1 insertion(+), 1 deletion(-)
+
+diff --git a/hello.txt b/hello.txt
+index 1111111..2222222 100644
+--- a/hello.txt
++++ b/hello.txt
+@@ -1 +1 @@
+-helo
++hello
+-- 
+2.43.0
+
+`
+
+func TestReadPatchFormatPatch(t *testing.T) {
+	d, err := ReadPatch(strings.NewReader(formatPatch), 1024, nil)
+	if err != nil {
+		t.Fatalf("ReadPatch: %v", err)
+	}
+	if len(d.Files) != 1 {
+		t.Fatalf("expected 1 file, got %+v", d.Files)
+	}
+	f := d.Files[0]
+	if f.Path != "hello.txt" || f.Added != 1 || f.Removed != 1 {
+		t.Errorf("unexpected file %+v", f)
+	}
+	if strings.Contains(d.Patch, "Subject:") || strings.Contains(d.Patch, "2.43.0") {
+		t.Errorf("mail headers or signature left in the patch:\n%s", d.Patch)
+	}
+	if !strings.HasPrefix(d.Patch, "diff --git a/hello.txt") || !strings.HasSuffix(d.Patch, "+hello\n") {
+		t.Errorf("unexpected patch:\n%s", d.Patch)
+	}
+}
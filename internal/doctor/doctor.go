@@ -2,10 +2,15 @@ package doctor
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
+
+	"github.com/joaquinalmora/commitgen/internal/config"
+	"github.com/joaquinalmora/commitgen/internal/provider"
 )
 
 func Run() error {
@@ -62,6 +67,8 @@ func Run() error {
 		}
 	}
 
+	checkProvider(&out)
+
 	if autosuggestAvailable() {
 		fmt.Fprintln(&out, "zsh-autosuggestions: detected")
 	} else {
@@ -76,6 +83,55 @@ func Run() error {
 	return fmt.Errorf("doctor detected issues; see output")
 }
 
+func checkProvider(out *bytes.Buffer) {
+	cfg := config.Load()
+
+	fmt.Fprintln(out, "registered AI providers:")
+	for _, f := range provider.Registered() {
+		status := "no API key required"
+		if f.APIKeyEnv != "" {
+			if os.Getenv(f.APIKeyEnv) != "" {
+				status = f.APIKeyEnv + " set"
+			} else {
+				status = f.APIKeyEnv + " not set"
+			}
+		}
+		fmt.Fprintf(out, "  %-10s %s (default model %s)\n", f.Name, status, f.DefaultModel)
+	}
+
+	for _, pc := range cfg.ProviderConfigs() {
+		checkBackend(out, pc)
+	}
+}
+
+func checkBackend(out *bytes.Buffer, pc provider.Config) {
+	fmt.Fprintf(out, "AI provider: %s (model %s)\n", pc.Provider, pc.Model)
+
+	if provider.RequiresAPIKey(pc) && pc.APIKey == "" {
+		fmt.Fprintln(out, "AI API key: not set (commitgen will use heuristics)")
+		return
+	}
+
+	p, err := provider.GetProvider(pc)
+	if err != nil {
+		fmt.Fprintf(out, "AI provider: not usable (%v)\n", err)
+		return
+	}
+
+	pinger, ok := p.(provider.Pinger)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := pinger.Ping(ctx); err != nil {
+		fmt.Fprintf(out, "local endpoint %s: unreachable (%v)\n", pc.BaseURL, err)
+	} else {
+		fmt.Fprintf(out, "local endpoint %s: reachable\n", pc.BaseURL)
+	}
+}
+
 func inGitRepo() bool {
 	if _, err := os.Stat(".git"); err == nil {
 		return true
@@ -35,6 +35,16 @@ func NoStagedChanges() UserError {
 	}
 }
 
+// NoChanges is NoStagedChanges for other sources, such as a revision range
+// or a patch read from standard input.
+func NoChanges(source string) UserError {
+	return UserError{
+		Message: fmt.Sprintf("No changes found in %s", source),
+		Help:    "Check the revision, range or patch you passed, or stage changes and run without a source flag",
+		Code:    1,
+	}
+}
+
 func InvalidAPIKey(provider string) UserError {
 	var helpMsg string
 	switch strings.ToLower(provider) {
@@ -42,6 +52,10 @@ func InvalidAPIKey(provider string) UserError {
 		helpMsg = "Get your API key from https://platform.openai.com/api-keys and set it with:\n" +
 			"  export OPENAI_API_KEY=your-key-here\n" +
 			"  Or add it to your ~/.env file"
+	case "anthropic":
+		helpMsg = "Get your API key from https://console.anthropic.com/settings/keys and set it with:\n" +
+			"  export ANTHROPIC_API_KEY=your-key-here\n" +
+			"  Or add it to your ~/.env file"
 	default:
 		helpMsg = fmt.Sprintf("Check your %s API key configuration", provider)
 	}
@@ -72,6 +86,15 @@ func NetworkError(err error) UserError {
 	}
 }
 
+func ProviderUnreachable(provider string, url string, err error) UserError {
+	return UserError{
+		Message: fmt.Sprintf("Cannot reach %s at %s: %v", provider, url, err),
+		Help: fmt.Sprintf("Make sure %s is running (for Ollama: 'ollama serve') or set ai.base_url. ", provider) +
+			"Commitgen will fall back to heuristic message generation.",
+		Code: 4,
+	}
+}
+
 func ConfigError(field string, value string) UserError {
 	return UserError{
 		Message: fmt.Sprintf("Invalid configuration: %s = %s", field, value),
@@ -87,3 +110,29 @@ func GitError(operation string, err error) UserError {
 		Code:    6,
 	}
 }
+
+// SplitFailed reports a commitgen split that stopped after creating some of
+// its commits.
+func SplitFailed(created, total int, err error) UserError {
+	return UserError{
+		Message: fmt.Sprintf("Split stopped after %d of %d commits: %v", created, total, err),
+		Help:    "The remaining changes are still staged. Fix the problem and run 'commitgen split' again, or commit them yourself",
+		Code:    6,
+	}
+}
+
+func RateLimited(provider string) UserError {
+	return UserError{
+		Message: fmt.Sprintf("%s API rate limit exceeded", provider),
+		Help:    fmt.Sprintf("Wait a moment and try again, or upgrade your %s plan", provider),
+		Code:    7,
+	}
+}
+
+func ServiceUnavailable(provider string) UserError {
+	return UserError{
+		Message: fmt.Sprintf("%s service temporarily unavailable", provider),
+		Help:    "Try again in a few moments or use '--cached' for a previous message",
+		Code:    8,
+	}
+}
@@ -1,6 +1,8 @@
 package errors
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -55,6 +57,29 @@ func TestNoStagedChanges(t *testing.T) {
 	}
 }
 
+func TestNoChanges(t *testing.T) {
+	err := NoChanges("range v1.0..v1.1")
+	if err.Code != 1 {
+		t.Errorf("Expected code 1, got %d", err.Code)
+	}
+	if !strings.Contains(err.Message, "range v1.0..v1.1") {
+		t.Errorf("Expected source in message, got %q", err.Message)
+	}
+	if err.Help == "" {
+		t.Error("Expected non-empty help")
+	}
+}
+
+func TestSplitFailed(t *testing.T) {
+	err := SplitFailed(1, 3, fmt.Errorf("git commit: hook failed"))
+	if err.Code != 6 {
+		t.Errorf("Expected code 6, got %d", err.Code)
+	}
+	if !strings.Contains(err.Message, "1 of 3") || !strings.Contains(err.Message, "hook failed") {
+		t.Errorf("Expected progress and cause in message, got %q", err.Message)
+	}
+}
+
 func TestInvalidAPIKey(t *testing.T) {
 	err := InvalidAPIKey("openai")
 	if err.Code != 2 {
@@ -122,3 +147,23 @@ func TestGitError(t *testing.T) {
 		t.Error("Expected non-empty help")
 	}
 }
+
+func TestRateLimited(t *testing.T) {
+	err := RateLimited("Anthropic")
+	if err.Code != 7 {
+		t.Errorf("Expected code 7, got %d", err.Code)
+	}
+	if !strings.Contains(err.Message, "Anthropic") {
+		t.Errorf("Expected provider name in message, got %q", err.Message)
+	}
+}
+
+func TestServiceUnavailable(t *testing.T) {
+	err := ServiceUnavailable("OpenAI")
+	if err.Code != 8 {
+		t.Errorf("Expected code 8, got %d", err.Code)
+	}
+	if err.Help == "" {
+		t.Error("Expected non-empty help")
+	}
+}
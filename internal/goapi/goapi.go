@@ -0,0 +1,355 @@
+// Package goapi compares the exported API of Go files before and after a
+// change, so that messages can name what was added, removed or changed
+// instead of guessing from keywords.
+package goapi
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+)
+
+// maxFiles bounds how many Go files are loaded for one diff; each costs two
+// git calls.
+const maxFiles = 100
+
+// ReadFunc returns a file's contents before or after the change, as
+// diff.Source.ReadFile does.
+type ReadFunc func(path string, after bool) ([]byte, error)
+
+// decl is one exported declaration.
+type decl struct {
+	kind string
+	sig  string
+	path string
+	// iface marks methods of an interface, whose addition breaks
+	// implementations
+	iface bool
+}
+
+type api struct {
+	pkg   string
+	decls map[string]decl
+}
+
+// Analyze loads both sides of every changed Go file in changes, skipping
+// tests and files whose hunks were left out, and records the differences
+// in exported declarations in changes.API. Declarations are compared per
+// directory, so moving a function between files of a package is not a
+// change.
+func Analyze(changes *diff.Diff, read ReadFunc) {
+	before := map[string]*api{}
+	after := map[string]*api{}
+	var dirs []string
+
+	loaded := 0
+	for _, f := range changes.Files {
+		if !strings.HasSuffix(f.Path, ".go") || strings.HasSuffix(f.Path, "_test.go") || f.Omitted != "" || f.Binary {
+			continue
+		}
+		if loaded >= maxFiles {
+			break
+		}
+		loaded++
+
+		oldPath := f.Path
+		if f.OldPath != "" {
+			oldPath = f.OldPath
+		}
+		if f.Status != diff.StatusAdded {
+			if src, err := read(oldPath, false); err == nil {
+				collect(before, &dirs, oldPath, src)
+			}
+		}
+		if f.Status != diff.StatusDeleted {
+			if src, err := read(f.Path, true); err == nil {
+				collect(after, &dirs, f.Path, src)
+			}
+		}
+	}
+
+	changes.API = nil
+	for _, dir := range dirs {
+		changes.API = append(changes.API, compare(before[dir], after[dir])...)
+	}
+}
+
+// Compare reports the exported API differences between two versions of a
+// single Go source file. Either side may be nil for an added or deleted
+// file.
+func Compare(filePath string, before, after []byte) []diff.APIChange {
+	var dirs []string
+	b, a := map[string]*api{}, map[string]*api{}
+	if before != nil {
+		collect(b, &dirs, filePath, before)
+	}
+	if after != nil {
+		collect(a, &dirs, filePath, after)
+	}
+	dir := path.Dir(filePath)
+	return compare(b[dir], a[dir])
+}
+
+// collect parses src and merges its exported declarations into the entry
+// for the file's directory. Files that do not parse are ignored.
+func collect(apis map[string]*api, dirs *[]string, filePath string, src []byte) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filePath, src, parser.SkipObjectResolution)
+	if err != nil {
+		return
+	}
+
+	dir := path.Dir(filePath)
+	a := apis[dir]
+	if a == nil {
+		a = &api{decls: map[string]decl{}}
+		apis[dir] = a
+		if !containsString(*dirs, dir) {
+			*dirs = append(*dirs, dir)
+		}
+	}
+	a.pkg = file.Name.Name
+
+	add := func(name string, d decl) {
+		d.path = filePath
+		a.decls[name] = d
+	}
+
+	for _, d := range file.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if !d.Name.IsExported() {
+				continue
+			}
+			if d.Recv == nil || len(d.Recv.List) == 0 {
+				add(d.Name.Name, decl{kind: "func", sig: funcSig(d.Type)})
+				continue
+			}
+			recv := baseTypeName(d.Recv.List[0].Type)
+			if ast.IsExported(recv) {
+				add(recv+"."+d.Name.Name, decl{kind: "method", sig: funcSig(d.Type)})
+			}
+
+		case *ast.GenDecl:
+			if d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if !ts.Name.IsExported() {
+					continue
+				}
+				name := ts.Name.Name
+				tparams := fieldTypes(ts.TypeParams, true)
+				if tparams != "" {
+					tparams = "[" + tparams + "]"
+				}
+
+				switch t := ts.Type.(type) {
+				case *ast.StructType:
+					add(name, decl{kind: "type", sig: "struct" + tparams})
+					for _, field := range t.Fields.List {
+						for _, fieldName := range namesOf(field) {
+							if ast.IsExported(fieldName) {
+								add(name+"."+fieldName, decl{kind: "field", sig: types.ExprString(field.Type)})
+							}
+						}
+					}
+				case *ast.InterfaceType:
+					add(name, decl{kind: "type", sig: "interface" + tparams})
+					for _, m := range t.Methods.List {
+						ft, isMethod := m.Type.(*ast.FuncType)
+						for _, mName := range namesOf(m) {
+							if !ast.IsExported(mName) {
+								continue
+							}
+							if isMethod {
+								add(name+"."+mName, decl{kind: "method", sig: funcSig(ft), iface: true})
+							} else {
+								add(name+"."+mName, decl{kind: "field", sig: types.ExprString(m.Type), iface: true})
+							}
+						}
+					}
+				default:
+					sig := types.ExprString(ts.Type)
+					if ts.Assign.IsValid() {
+						sig = "= " + sig
+					}
+					add(name, decl{kind: "type", sig: tparams + sig})
+				}
+			}
+		}
+	}
+}
+
+// compare diffs two API snapshots of one directory. Added and changed
+// declarations come first, each group sorted by name.
+func compare(before, after *api) []diff.APIChange {
+	if before == nil {
+		before = &api{decls: map[string]decl{}}
+	}
+	if after == nil {
+		after = &api{decls: map[string]decl{}}
+	}
+	pkg := after.pkg
+	if pkg == "" {
+		pkg = before.pkg
+	}
+
+	var changes []diff.APIChange
+	for _, name := range sortedKeys(after.decls) {
+		a := after.decls[name]
+		b, existed := before.decls[name]
+		switch {
+		case !existed:
+			if parentAdded(name, before, after) {
+				// Listing every field of a new type adds nothing
+				continue
+			}
+			changes = append(changes, diff.APIChange{
+				Kind: diff.APIAdded, Decl: a.kind, Package: pkg, Name: name, Path: a.path,
+				After: a.sig, Breaking: a.iface && a.kind == "method",
+			})
+		case b.sig != a.sig || b.kind != a.kind:
+			changes = append(changes, diff.APIChange{
+				Kind: diff.APIChanged, Decl: a.kind, Package: pkg, Name: name, Path: a.path,
+				Before: b.sig, After: a.sig, Breaking: true,
+			})
+		}
+	}
+	for _, name := range sortedKeys(before.decls) {
+		b := before.decls[name]
+		if _, ok := after.decls[name]; ok || parentRemoved(name, before, after) {
+			continue
+		}
+		changes = append(changes, diff.APIChange{
+			Kind: diff.APIRemoved, Decl: b.kind, Package: pkg, Name: name, Path: b.path,
+			Before: b.sig, Breaking: true,
+		})
+	}
+	return changes
+}
+
+// parentAdded reports whether name is a member of a type that is itself new.
+func parentAdded(name string, before, after *api) bool {
+	parent, _, ok := strings.Cut(name, ".")
+	if !ok {
+		return false
+	}
+	_, inAfter := after.decls[parent]
+	_, inBefore := before.decls[parent]
+	return inAfter && !inBefore && after.decls[parent].kind == "type"
+}
+
+// parentRemoved reports whether name is a member of a type that is gone.
+func parentRemoved(name string, before, after *api) bool {
+	parent, _, ok := strings.Cut(name, ".")
+	if !ok {
+		return false
+	}
+	_, inAfter := after.decls[parent]
+	_, inBefore := before.decls[parent]
+	return inBefore && !inAfter && before.decls[parent].kind == "type"
+}
+
+// funcSig prints a function type without parameter names, which callers
+// do not depend on, e.g. "func(string, ...int) (int, error)".
+func funcSig(ft *ast.FuncType) string {
+	var b strings.Builder
+	b.WriteString("func")
+	if tparams := fieldTypes(ft.TypeParams, true); tparams != "" {
+		b.WriteString("[" + tparams + "]")
+	}
+	b.WriteString("(" + fieldTypes(ft.Params, false) + ")")
+
+	results := fieldTypes(ft.Results, false)
+	switch {
+	case results == "":
+	case ft.Results.NumFields() == 1:
+		b.WriteString(" " + results)
+	default:
+		b.WriteString(" (" + results + ")")
+	}
+	return b.String()
+}
+
+// fieldTypes lists the types in a field list, one per name. With names set
+// the names are kept, as for type parameters.
+func fieldTypes(fl *ast.FieldList, names bool) string {
+	if fl == nil {
+		return ""
+	}
+	var parts []string
+	for _, f := range fl.List {
+		t := types.ExprString(f.Type)
+		if names && len(f.Names) > 0 {
+			var ns []string
+			for _, n := range f.Names {
+				ns = append(ns, n.Name)
+			}
+			parts = append(parts, strings.Join(ns, ", ")+" "+t)
+			continue
+		}
+		for i := 0; i < max(1, len(f.Names)); i++ {
+			parts = append(parts, t)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// namesOf returns a field's names, or the type name for an embedded field.
+func namesOf(f *ast.Field) []string {
+	if len(f.Names) == 0 {
+		return []string{baseTypeName(f.Type)}
+	}
+	names := make([]string, len(f.Names))
+	for i, n := range f.Names {
+		names[i] = n.Name
+	}
+	return names
+}
+
+// baseTypeName strips pointers, type arguments and package qualifiers, so
+// that "*Cache[K, V]" and "sync.Mutex" give "Cache" and "Mutex".
+func baseTypeName(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.SelectorExpr:
+			return e.Sel.Name
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+func sortedKeys(m map[string]decl) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
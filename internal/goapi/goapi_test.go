@@ -0,0 +1,140 @@
+package goapi
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+)
+
+const before = `package cache
+
+import "time"
+
+type Cache struct {
+	mu    sync.Mutex
+	items map[string]string
+	TTL   time.Duration
+	Dir   string
+}
+
+type Store interface {
+	Get(key string) (string, error)
+}
+
+func New(dir string) *Cache { return nil }
+
+func Open(dir string) (*Cache, error) { return nil, nil }
+
+func (c *Cache) Get(key string) (string, bool) { return "", false }
+
+func (c *Cache) evict() {}
+
+func helper() {}
+`
+
+const after = `package cache
+
+import "time"
+
+type Cache struct {
+	mu    sync.Mutex
+	items map[string]string
+	TTL   int64
+	Dir   string
+	Max   int
+}
+
+type Store interface {
+	Get(key string) (string, error)
+	Delete(key string) error
+}
+
+type Entry[T any] struct {
+	Value T
+	At    time.Time
+}
+
+func New(dir string, opts ...Option) *Cache { return nil }
+
+func (c *Cache) Get(k string) (string, bool) { return "", false }
+
+func (c *Cache) Delete(key string) {}
+
+func (c *Cache) evict(n int) {}
+
+func helper(n int) {}
+`
+
+func TestCompare(t *testing.T) {
+	var got []string
+	for _, c := range Compare("cache/cache.go", []byte(before), []byte(after)) {
+		got = append(got, c.String())
+	}
+
+	want := []string{
+		"added method Cache.Delete in package cache",
+		"added field Cache.Max in package cache",
+		"changed field Cache.TTL in package cache: time.Duration -> int64 (potentially breaking)",
+		"added type Entry in package cache",
+		"changed func New in package cache: func(string) *Cache -> func(string, ...Option) *Cache (potentially breaking)",
+		"added method Store.Delete in package cache (potentially breaking)",
+		"removed func Open in package cache (potentially breaking)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected changes:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCompareNewAndDeletedFiles(t *testing.T) {
+	added := Compare("cache/cache.go", nil, []byte(before))
+	if len(added) != 4 {
+		t.Errorf("expected Cache, Store, New and Open, got %v", added)
+	}
+	for _, c := range added {
+		if c.Kind != diff.APIAdded || c.Breaking {
+			t.Errorf("unexpected change for a new file: %v", c)
+		}
+	}
+
+	removed := Compare("cache/cache.go", []byte(before), nil)
+	if len(removed) != 4 || removed[0].Kind != diff.APIRemoved || !removed[0].Breaking {
+		t.Errorf("unexpected changes for a deleted file: %v", removed)
+	}
+
+	if got := Compare("broken.go", []byte("package x\nfunc ("), []byte("package x\nfunc A() {}\n")); len(got) != 1 {
+		t.Errorf("a side that does not parse should count as empty, got %v", got)
+	}
+}
+
+func TestAnalyzeMovesBetweenFiles(t *testing.T) {
+	files := map[string]string{
+		"before:cache/a.go":     "package cache\n\nfunc Load() {}\n",
+		"before:cache/b.go":     "package cache\n",
+		"after:cache/a.go":      "package cache\n",
+		"after:cache/b.go":      "package cache\n\nfunc Load() {}\n\nfunc Save() {}\n",
+		"after:cache/b_test.go": "package cache\n\nfunc TestX() {}\n",
+	}
+	read := func(path string, after bool) ([]byte, error) {
+		side := "before:"
+		if after {
+			side = "after:"
+		}
+		src, ok := files[side+path]
+		if !ok {
+			return nil, fmt.Errorf("missing %s", path)
+		}
+		return []byte(src), nil
+	}
+
+	changes := diff.FromPatch([]string{"cache/a.go", "cache/b.go", "cache/b_test.go", "README.md"}, "")
+	Analyze(changes, read)
+
+	if len(changes.API) != 1 {
+		t.Fatalf("expected only Save to be reported, got %v", changes.API)
+	}
+	if c := changes.API[0]; c.Name != "Save" || c.Kind != diff.APIAdded || c.Path != "cache/b.go" {
+		t.Errorf("unexpected change %+v", c)
+	}
+}
@@ -0,0 +1,160 @@
+package message
+
+import "strings"
+
+// Wrap reflows text to width columns. Paragraphs stay separated by a blank
+// line, bullet items start a new line with their continuation lines
+// indented to match, and paragraphs made only of footers are kept as they
+// are.
+func Wrap(text string, width int) string {
+	var paragraphs []string
+	for _, para := range splitParagraphs(strings.Split(text, "\n")) {
+		if isFooterBlock(para) {
+			paragraphs = append(paragraphs, strings.Join(para, "\n"))
+		} else {
+			paragraphs = append(paragraphs, wrapParagraph(para, width))
+		}
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// IsFooter reports whether line is a git trailer such as "Refs: #12",
+// "Fixes #34" or "BREAKING CHANGE: ...".
+func IsFooter(line string) bool {
+	if strings.HasPrefix(line, "BREAKING CHANGE: ") || strings.HasPrefix(line, "BREAKING-CHANGE: ") {
+		return true
+	}
+
+	i := strings.IndexAny(line, ": ")
+	if i <= 0 {
+		return false
+	}
+	for _, r := range line[:i] {
+		if !(r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return strings.HasPrefix(line[i:], ": ") || strings.HasPrefix(line[i:], " #")
+}
+
+// ShortenSubject cuts a subject line down to SubjectLimit characters at a
+// word boundary, avoiding a dangling connector word at the end.
+func ShortenSubject(line string) string {
+	if len(line) <= SubjectLimit {
+		return line
+	}
+
+	words := strings.Fields(line)
+	var result []string
+	length := 0
+
+	for _, word := range words {
+		if length+len(word)+1 > SubjectLimit {
+			break
+		}
+		result = append(result, word)
+		length += len(word) + 1
+	}
+
+	if len(result) == 0 {
+		return line[:SubjectLimit-3] + "..."
+	}
+
+	// Check if the last word is a connector word that suggests incomplete thought
+	lastWord := strings.ToLower(result[len(result)-1])
+	if lastWord == "and" || lastWord == "or" || lastWord == "but" || lastWord == "with" || lastWord == "for" || lastWord == "to" {
+		// Remove the connector word to avoid incomplete sentences
+		if len(result) > 1 {
+			return strings.Join(result[:len(result)-1], " ")
+		}
+		// If only connector word, fall back to character truncation
+		return line[:SubjectLimit-3] + "..."
+	}
+	return strings.Join(result, " ")
+}
+
+// splitParagraphs groups lines into blank-line separated paragraphs with
+// trailing whitespace removed.
+func splitParagraphs(lines []string) [][]string {
+	var paragraphs [][]string
+	var current []string
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if strings.TrimSpace(line) == "" {
+			if len(current) > 0 {
+				paragraphs = append(paragraphs, current)
+				current = nil
+			}
+			continue
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 {
+		paragraphs = append(paragraphs, current)
+	}
+	return paragraphs
+}
+
+func isFooterBlock(lines []string) bool {
+	for _, line := range lines {
+		if !IsFooter(line) {
+			return false
+		}
+	}
+	return true
+}
+
+// wrapParagraph reflows one paragraph to width columns.
+func wrapParagraph(lines []string, width int) string {
+	var out []string
+	var words []string
+	indent := ""
+
+	flush := func() {
+		if len(words) == 0 {
+			return
+		}
+		line := ""
+		for _, word := range words {
+			switch {
+			case line == "":
+				line = word
+			case len(line)+1+len(word) > width:
+				out = append(out, line)
+				line = indent + word
+			default:
+				line += " " + word
+			}
+		}
+		out = append(out, line)
+		words = nil
+	}
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		fields := strings.Fields(trimmed)
+		if bullet := bulletPrefix(trimmed); bullet != "" {
+			flush()
+			indent = strings.Repeat(" ", len(bullet))
+			// Keep the bullet marker attached to its first word
+			fields = strings.Fields(trimmed[len(bullet):])
+			if len(fields) == 0 {
+				continue
+			}
+			fields[0] = bullet + fields[0]
+		}
+		words = append(words, fields...)
+	}
+	flush()
+
+	return strings.Join(out, "\n")
+}
+
+func bulletPrefix(line string) string {
+	for _, prefix := range []string{"- ", "* "} {
+		if strings.HasPrefix(line, prefix) {
+			return prefix
+		}
+	}
+	return ""
+}
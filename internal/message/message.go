@@ -0,0 +1,196 @@
+// Package message models a conventional commit message and renders it in
+// the one format shared by providers, the git hook and the shell snippet.
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SubjectLimit is the longest header line commitgen produces.
+const SubjectLimit = 72
+
+// Types lists the conventional commit types a Message may use.
+var Types = []string{"feat", "fix", "docs", "style", "refactor", "test", "chore", "perf", "ci", "build", "revert"}
+
+// Message is a commit message split into its conventional commit parts.
+type Message struct {
+	Type     string   `json:"type"`
+	Scope    string   `json:"scope"`
+	Subject  string   `json:"subject"`
+	Body     string   `json:"body"`
+	Breaking bool     `json:"breaking"`
+	Footers  []string `json:"footers"`
+}
+
+// Decode parses a JSON object produced against Schema, normalises it and
+// validates the result.
+func Decode(data []byte) (Message, error) {
+	var m Message
+	if err := json.Unmarshal(data, &m); err != nil {
+		return Message{}, fmt.Errorf("invalid message JSON: %w", err)
+	}
+	m.Normalize()
+	if err := m.Validate(); err != nil {
+		return Message{}, err
+	}
+	return m, nil
+}
+
+// Normalize tidies up the small mistakes models commonly make: stray case
+// and whitespace, a trailing period, or a type repeated in the subject.
+func (m *Message) Normalize() {
+	m.Type = strings.ToLower(strings.TrimSpace(m.Type))
+	m.Scope = strings.Trim(strings.TrimSpace(m.Scope), "()")
+	m.Subject = strings.TrimSpace(m.Subject)
+	if prefix := m.Type + ": "; m.Type != "" && strings.HasPrefix(strings.ToLower(m.Subject), prefix) {
+		m.Subject = strings.TrimSpace(m.Subject[len(prefix):])
+	}
+	m.Subject = strings.TrimRight(m.Subject, ".")
+	m.Body = strings.TrimSpace(m.Body)
+
+	footers := m.Footers[:0]
+	for _, f := range m.Footers {
+		if f = strings.TrimSpace(f); f != "" {
+			footers = append(footers, f)
+		}
+	}
+	m.Footers = footers
+}
+
+// Validate reports the first field that cannot be rendered as a
+// conventional commit.
+func (m Message) Validate() error {
+	if !isType(m.Type) {
+		return fmt.Errorf("unknown commit type %q", m.Type)
+	}
+	if strings.ContainsAny(m.Scope, " \n()") {
+		return fmt.Errorf("invalid scope %q", m.Scope)
+	}
+	if m.Subject == "" {
+		return fmt.Errorf("empty subject")
+	}
+	if strings.Contains(m.Subject, "\n") {
+		return fmt.Errorf("subject spans several lines")
+	}
+	for _, f := range m.Footers {
+		if strings.Contains(f, "\n") || !IsFooter(f) {
+			return fmt.Errorf("invalid footer %q", f)
+		}
+	}
+	return nil
+}
+
+// Header returns the first line, e.g. "feat(api)!: add upload endpoint",
+// shortened at a word boundary to SubjectLimit characters.
+func (m Message) Header() string {
+	var b strings.Builder
+	b.WriteString(m.Type)
+	if m.Scope != "" {
+		b.WriteString("(" + m.Scope + ")")
+	}
+	if m.Breaking && !m.hasBreakingFooter() {
+		b.WriteString("!")
+	}
+	b.WriteString(": ")
+	b.WriteString(m.Subject)
+	return ShortenSubject(b.String())
+}
+
+// ParseHeader splits a header line such as "feat(api)!: add upload" into
+// its type, scope, breaking marker and subject. ok is false when the line
+// does not start with a conventional commit type.
+func ParseHeader(line string) (m Message, ok bool) {
+	prefix, subject, found := strings.Cut(line, ": ")
+	if !found {
+		return Message{}, false
+	}
+	if strings.HasSuffix(prefix, "!") {
+		m.Breaking = true
+		prefix = strings.TrimSuffix(prefix, "!")
+	}
+	if open := strings.Index(prefix, "("); open >= 0 && strings.HasSuffix(prefix, ")") {
+		m.Scope = prefix[open+1 : len(prefix)-1]
+		prefix = prefix[:open]
+	}
+	if prefix == "" || strings.ContainsAny(prefix, " ()") {
+		return Message{}, false
+	}
+	m.Type = prefix
+	m.Subject = strings.TrimSpace(subject)
+	return m, true
+}
+
+// String renders the header followed, when withBody is set, by the body
+// wrapped at SubjectLimit columns and the footers.
+func (m Message) String(withBody bool) string {
+	header := m.Header()
+	if !withBody {
+		return header
+	}
+
+	parts := []string{header}
+	if m.Body != "" {
+		parts = append(parts, Wrap(m.Body, SubjectLimit))
+	}
+	if len(m.Footers) > 0 {
+		parts = append(parts, strings.Join(m.Footers, "\n"))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func (m Message) hasBreakingFooter() bool {
+	for _, f := range m.Footers {
+		if strings.HasPrefix(f, "BREAKING CHANGE:") || strings.HasPrefix(f, "BREAKING-CHANGE:") {
+			return true
+		}
+	}
+	return false
+}
+
+func isType(t string) bool {
+	for _, known := range Types {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Schema returns the JSON schema that structured-output backends are asked
+// to follow. Every property is required so that it is valid in OpenAI's
+// strict mode; empty strings and arrays stand in for absent parts.
+func Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"type": map[string]interface{}{
+				"type": "string",
+				"enum": Types,
+			},
+			"scope": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional area of the codebase, empty when none applies",
+			},
+			"subject": map[string]interface{}{
+				"type":        "string",
+				"description": "Imperative summary without type prefix or trailing period",
+			},
+			"body": map[string]interface{}{
+				"type":        "string",
+				"description": "What changed and why; empty for trivial changes",
+			},
+			"breaking": map[string]interface{}{
+				"type": "boolean",
+			},
+			"footers": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Git trailers such as \"Fixes #123\" or \"BREAKING CHANGE: ...\"",
+			},
+		},
+		"required":             []string{"type", "scope", "subject", "body", "breaking", "footers"},
+		"additionalProperties": false,
+	}
+}
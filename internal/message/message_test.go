@@ -0,0 +1,85 @@
+package message
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeRendersConventionalCommit(t *testing.T) {
+	m, err := Decode([]byte(`{"type":"Feat","scope":"(api)","subject":"feat: add profile image upload.","body":"Users can now upload and update their profile pictures, which are resized before they are stored.","breaking":true,"footers":["Closes #142",""]}`))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	if got := m.String(false); got != "feat(api)!: add profile image upload" {
+		t.Errorf("unexpected header %q", got)
+	}
+
+	want := "feat(api)!: add profile image upload\n\n" +
+		"Users can now upload and update their profile pictures, which are\n" +
+		"resized before they are stored.\n\n" +
+		"Closes #142"
+	if got := m.String(true); got != want {
+		t.Errorf("unexpected message:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestBreakingFooterReplacesBang(t *testing.T) {
+	m := Message{Type: "feat", Subject: "drop v1 API", Breaking: true, Footers: []string{"BREAKING CHANGE: v1 endpoints are gone"}}
+	if got := m.Header(); got != "feat: drop v1 API" {
+		t.Errorf("unexpected header %q", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{"unknown type", `{"type":"feature","subject":"add x"}`},
+		{"empty subject", `{"type":"fix","subject":"  "}`},
+		{"scope with spaces", `{"type":"fix","scope":"the api","subject":"handle x"}`},
+		{"multi-line subject", `{"type":"fix","subject":"handle x\nand y"}`},
+		{"bad footer", `{"type":"fix","subject":"handle x","footers":["see the issue tracker"]}`},
+		{"not an object", `["fix"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode([]byte(tt.json)); err == nil {
+				t.Error("expected validation error")
+			}
+		})
+	}
+}
+
+func TestHeaderIsShortened(t *testing.T) {
+	m := Message{Type: "refactor", Scope: "provider", Subject: strings.Repeat("word ", 20) + "end"}
+	if got := m.Header(); len(got) > SubjectLimit {
+		t.Errorf("header longer than %d characters: %q", SubjectLimit, got)
+	}
+}
+
+func TestWrapKeepsBulletsAndFooters(t *testing.T) {
+	text := "- supports JPEG, PNG and WebP formats up to five megabytes in size for every user\n\nFixes #1\nRefs: #2"
+	want := "- supports JPEG, PNG and WebP formats up to five megabytes in size for\n  every user\n\nFixes #1\nRefs: #2"
+	if got := Wrap(text, 72); got != want {
+		t.Errorf("unexpected wrap:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	m, ok := ParseHeader("feat(api)!: add upload endpoint")
+	if !ok || m.Type != "feat" || m.Scope != "api" || !m.Breaking || m.Subject != "add upload endpoint" {
+		t.Errorf("unexpected parse %+v, %v", m, ok)
+	}
+	if m.Header() != "feat(api)!: add upload endpoint" {
+		t.Errorf("header does not round-trip: %q", m.Header())
+	}
+
+	for _, line := range []string{"Update documentation", ": empty type", "Merge branch 'main': sync"} {
+		if _, ok := ParseHeader(line); ok {
+			t.Errorf("expected %q not to parse", line)
+		}
+	}
+}
@@ -4,17 +4,71 @@ import (
 	"fmt"
 	"path/filepath"
 	"strings"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+	"github.com/joaquinalmora/commitgen/internal/scope"
 )
 
+// MakePrompt suggests a commit message for a list of files and their
+// patch, with a scope inferred from the files' directories.
 func MakePrompt(files []string, patch string) string {
+	changes := diff.FromPatch(files, patch)
+	changes.Scope = scope.Infer(changes, scope.Options{})
+	return FromDiff(changes)
+}
+
+// FromDiff suggests a commit message from parsed changes without calling
+// any AI provider. changes.Scope is added to messages that have no scope
+// of their own.
+func FromDiff(changes *diff.Diff) string {
+	return withScope(suggest(changes), changes.Scope)
+}
+
+// withScope inserts scope into the header of msg, unless the header already
+// has one or the scope would only repeat the type, as in "docs(docs)".
+func withScope(msg, scope string) string {
+	i := strings.Index(msg, ":")
+	if scope == "" || i < 0 {
+		return msg
+	}
+	typ := msg[:i]
+	bang := ""
+	if strings.HasSuffix(typ, "!") {
+		typ, bang = strings.TrimSuffix(typ, "!"), "!"
+	}
+	if strings.Contains(typ, "(") || typ == scope {
+		return msg
+	}
+	return typ + "(" + scope + ")" + bang + msg[i:]
+}
+
+// WithTypes makes msg use one of the allowed conventional-commit types. A
+// message whose type is not allowed gets "chore" if that is, otherwise the
+// first allowed type; messages without a type and an empty list of types
+// leave msg unchanged.
+func WithTypes(msg string, types []string) string {
+	i := strings.IndexAny(msg, "(!:")
+	if len(types) == 0 || i < 0 || !strings.Contains(msg, ":") || strings.Contains(msg[:i], " ") || contains(types, msg[:i]) {
+		return msg
+	}
+	replacement := types[0]
+	if contains(types, "chore") {
+		replacement = "chore"
+	}
+	return replacement + msg[i:]
+}
+
+func suggest(changes *diff.Diff) string {
 	n := 2
+	files := changes.Paths()
+	patch := changes.Patch
 
 	if len(files) == 0 {
 		return "chore: add missing files"
 	}
 
 	if isTestsOnly(files) {
-		return analyzeTestChanges(patch)
+		return analyzeTestChanges(changes)
 	}
 	if isDocsOnly(files) {
 		return analyzeDocChanges(patch)
@@ -24,11 +78,15 @@ func MakePrompt(files []string, patch string) string {
 		return analyzeConfigChanges(patch)
 	}
 
-	if isRenameOnly(patch) {
+	if isRenameOnly(changes) {
 		return "refactor: rename files for clarity"
 	}
 
-	commitType := analyzeCommitType(patch)
+	if msg := fromAPI(changes.API, changes.Scope); msg != "" {
+		return msg
+	}
+
+	commitType := analyzeCommitType(changes)
 
 	if len(files) < n {
 		n = len(files)
@@ -44,8 +102,83 @@ func MakePrompt(files []string, patch string) string {
 	return fmt.Sprintf("%s: update %s", commitType, base)
 }
 
-func analyzeCommitType(patch string) string {
-	lowerPatch := strings.ToLower(patch)
+// fromAPI names exported API changes, e.g. "feat(cache): add
+// Cache.Delete". Adding API is a feature, anything else a refactor, and
+// potentially breaking changes are marked with "!". The scope is the
+// inferred one if there is one, otherwise the package name. It returns ""
+// when there are no API changes.
+func fromAPI(api []diff.APIChange, inferred string) string {
+	if len(api) == 0 {
+		return ""
+	}
+
+	var added, changed, removed []string
+	scope := api[0].Package
+	breaking := false
+	for _, c := range api {
+		if c.Package != scope {
+			scope = ""
+		}
+		breaking = breaking || c.Breaking
+		switch c.Kind {
+		case diff.APIAdded:
+			added = append(added, c.Name)
+		case diff.APIChanged:
+			changed = append(changed, c.Name)
+		case diff.APIRemoved:
+			removed = append(removed, c.Name)
+		}
+	}
+
+	header := "refactor"
+	if len(added) > 0 {
+		header = "feat"
+	}
+	if inferred != "" {
+		scope = inferred
+	}
+	if scope != "" && scope != "main" {
+		header += "(" + scope + ")"
+	}
+	if breaking {
+		header += "!"
+	}
+
+	var parts []string
+	if len(added) > 0 {
+		parts = append(parts, "add "+listNames(added))
+	}
+	if len(changed) > 0 {
+		parts = append(parts, "change "+listNames(changed))
+	}
+	if len(removed) > 0 {
+		parts = append(parts, "remove "+listNames(removed))
+	}
+
+	subject := parts[0]
+	for _, p := range parts[1:] {
+		if len(header)+len(subject)+len(p) > 66 {
+			break
+		}
+		subject += ", " + p
+	}
+	return header + ": " + subject
+}
+
+// listNames joins names as "A", "A and B" or "A, B and 3 more".
+func listNames(names []string) string {
+	switch len(names) {
+	case 1:
+		return names[0]
+	case 2:
+		return names[0] + " and " + names[1]
+	default:
+		return fmt.Sprintf("%s, %s and %d more", names[0], names[1], len(names)-2)
+	}
+}
+
+func analyzeCommitType(changes *diff.Diff) string {
+	lowerPatch := strings.ToLower(changes.Patch)
 
 	if strings.Contains(lowerPatch, "fix") ||
 		strings.Contains(lowerPatch, "bug") ||
@@ -79,8 +212,7 @@ func analyzeCommitType(patch string) string {
 		return "style"
 	}
 
-	addedLines := strings.Count(patch, "\n+")
-	removedLines := strings.Count(patch, "\n-")
+	addedLines, removedLines := changes.Stats()
 
 	if addedLines > removedLines*2 {
 		return "feat"
@@ -89,15 +221,14 @@ func analyzeCommitType(patch string) string {
 	return "chore"
 }
 
-func analyzeTestChanges(patch string) string {
-	lowerPatch := strings.ToLower(patch)
+func analyzeTestChanges(changes *diff.Diff) string {
+	lowerPatch := strings.ToLower(changes.Patch)
 
 	if strings.Contains(lowerPatch, "fix") {
 		return "test: fix failing tests"
 	}
 
-	addedLines := strings.Count(patch, "\n+")
-	removedLines := strings.Count(patch, "\n-")
+	addedLines, removedLines := changes.Stats()
 
 	if addedLines > removedLines {
 		return "test: add test coverage"
@@ -219,16 +350,11 @@ func isConfigOnly(files []string) bool {
 	return true
 }
 
-func isRenameOnly(patch string) bool {
-	lf := strings.ToLower(patch)
-
-	if !(strings.Contains(lf, "rename from") && strings.Contains(lf, "rename to")) {
-		return false
-	}
-
-	if strings.Contains(lf, "@@") {
-		return false
+func isRenameOnly(changes *diff.Diff) bool {
+	for _, f := range changes.Files {
+		if f.Status != diff.StatusRenamed || f.Added > 0 || f.Removed > 0 {
+			return false
+		}
 	}
-
 	return true
 }
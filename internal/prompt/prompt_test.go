@@ -3,6 +3,8 @@ package prompt
 import (
 	"strings"
 	"testing"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
 )
 
 func TestMakePromptSingleLine(t *testing.T) {
@@ -26,3 +28,65 @@ func TestMakePromptSingleLine(t *testing.T) {
 		}
 	}
 }
+
+func TestFromDiffNamesAPIChanges(t *testing.T) {
+	changes := diff.FromPatch([]string{"cache/cache.go"}, "")
+
+	changes.API = []diff.APIChange{{Kind: diff.APIAdded, Decl: "method", Package: "cache", Name: "Cache.Delete"}}
+	if msg := FromDiff(changes); msg != "feat(cache): add Cache.Delete" {
+		t.Errorf("unexpected message %q", msg)
+	}
+
+	changes.API = []diff.APIChange{
+		{Kind: diff.APIChanged, Decl: "func", Package: "cache", Name: "New", Breaking: true},
+		{Kind: diff.APIRemoved, Decl: "func", Package: "cache", Name: "Open", Breaking: true},
+		{Kind: diff.APIRemoved, Decl: "type", Package: "store", Name: "Store", Breaking: true},
+	}
+	if msg := FromDiff(changes); msg != "refactor!: change New, remove Open and Store" {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
+
+func TestFromDiffAddsScope(t *testing.T) {
+	cases := []struct {
+		files  []string
+		api    []diff.APIChange
+		scope  string
+		expect string
+	}{
+		{[]string{"internal/cache/cache.go"}, []diff.APIChange{{Kind: diff.APIRemoved, Decl: "func", Package: "cache", Name: "Open", Breaking: true}}, "cache", "refactor(cache)!: remove Open"},
+		{[]string{"internal/cache/cache.go"}, []diff.APIChange{{Kind: diff.APIAdded, Decl: "func", Package: "lru", Name: "New"}}, "", "feat(lru): add New"},
+		// A configured or inferred scope overrides the package name
+		{[]string{"internal/cache/cache.go"}, []diff.APIChange{{Kind: diff.APIAdded, Decl: "func", Package: "lru", Name: "New"}}, "http", "feat(http): add New"},
+		{[]string{"docs/usage.md"}, nil, "docs", "docs: update documentation"},
+	}
+
+	for _, c := range cases {
+		changes := diff.FromPatch(c.files, "")
+		changes.API = c.api
+		changes.Scope = c.scope
+		if msg := FromDiff(changes); msg != c.expect {
+			t.Errorf("FromDiff(%v) = %q, want %q", c.files, msg, c.expect)
+		}
+	}
+}
+
+func TestWithTypes(t *testing.T) {
+	cases := []struct {
+		msg    string
+		types  []string
+		expect string
+	}{
+		{"refactor(cache)!: remove Open", nil, "refactor(cache)!: remove Open"},
+		{"refactor(cache)!: remove Open", []string{"feat", "fix", "chore"}, "chore(cache)!: remove Open"},
+		{"test: update tests", []string{"feat", "fix"}, "feat: update tests"},
+		{"fix: handle nil", []string{"feat", "fix"}, "fix: handle nil"},
+		{"Update documentation", []string{"feat"}, "Update documentation"},
+	}
+
+	for _, c := range cases {
+		if got := WithTypes(c.msg, c.types); got != c.expect {
+			t.Errorf("WithTypes(%q, %v) = %q, want %q", c.msg, c.types, got, c.expect)
+		}
+	}
+}
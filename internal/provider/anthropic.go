@@ -0,0 +1,328 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+	"github.com/joaquinalmora/commitgen/internal/errors"
+	"github.com/joaquinalmora/commitgen/internal/message"
+)
+
+const (
+	anthropicVersion    = "2023-06-01"
+	defaultAnthropicURL = "https://api.anthropic.com/v1"
+)
+
+func init() {
+	Register(Factory{
+		Name:           "anthropic",
+		DisplayName:    "Anthropic",
+		APIKeyEnv:      "ANTHROPIC_API_KEY",
+		DefaultBaseURL: defaultAnthropicURL,
+		DefaultModel:   "claude-3-5-haiku-latest",
+		RequiresKey:    true,
+		New:            NewAnthropicProvider,
+	})
+}
+
+type AnthropicProvider struct {
+	apiKey      string
+	model       string
+	baseURL     string
+	client      *http.Client
+	stream      *http.Client
+	retry       RetryPolicy
+	temperature float64
+	prompt      promptOptions
+}
+
+type anthropicRequest struct {
+	Model       string        `json:"model"`
+	System      string        `json:"system,omitempty"`
+	Messages    []chatMessage `json:"messages"`
+	MaxTokens   int           `json:"max_tokens"`
+	Temperature float64       `json:"temperature"`
+	Stream      bool          `json:"stream,omitempty"`
+
+	Tools      []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice *anthropicToolChoice `json:"tool_choice,omitempty"`
+}
+
+// anthropicTool declares the tool the model is made to call so that its
+// input, which must match InputSchema, carries the message fields.
+type anthropicTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type anthropicResponse struct {
+	Content    []anthropicContent `json:"content"`
+	StopReason string             `json:"stop_reason"`
+	Error      *anthropicError    `json:"error,omitempty"`
+}
+
+type anthropicContent struct {
+	Type  string          `json:"type"`
+	Text  string          `json:"text"`
+	Input json.RawMessage `json:"input,omitempty"`
+}
+
+type anthropicStreamEvent struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+}
+
+type anthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+func NewAnthropicProvider(config Config) (Provider, error) {
+	if config.APIKey == "" {
+		return nil, errors.InvalidAPIKey("Anthropic")
+	}
+
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = defaultAnthropicURL
+	}
+
+	model := config.Model
+	if model == "" {
+		model = "claude-3-5-haiku-latest"
+	}
+
+	return &AnthropicProvider{
+		apiKey:      config.APIKey,
+		model:       model,
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		client:      newHTTPClient(config, 30*time.Second),
+		stream:      newStreamClient(config, 30*time.Second),
+		retry:       config.Retry,
+		temperature: config.temperature(),
+		prompt:      config.promptOptions(model),
+	}, nil
+}
+
+func (p *AnthropicProvider) Name() string {
+	return "anthropic"
+}
+
+func (p *AnthropicProvider) IsConfigured() bool {
+	return p.apiKey != ""
+}
+
+// GenerateCommitMessage forces a call to a tool whose input schema is
+// message.Schema, so that the reply holds the message fields. Servers that
+// reject tools are asked again for plain text.
+func (p *AnthropicProvider) GenerateCommitMessage(ctx context.Context, changes *diff.Diff) (string, error) {
+	reqBody := p.newRequest(changes, false)
+	resp, err := p.send(ctx, reqBody)
+	if err == errFormatRejected {
+		rememberRejection(p.baseURL)
+		reqBody = p.newRequest(changes, false)
+		resp, err = p.send(ctx, reqBody)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var anthropicResp anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&anthropicResp); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if anthropicResp.Error != nil {
+		return "", errors.AIProviderError("Anthropic", fmt.Errorf("%s", anthropicResp.Error.Message))
+	}
+
+	if reqBody.Tools != nil {
+		for _, block := range anthropicResp.Content {
+			if block.Type != "tool_use" {
+				continue
+			}
+			msg, err := finishStructured("Anthropic", string(block.Input), p.prompt.body)
+			if err != nil {
+				return "", errors.AIProviderError("Anthropic", err)
+			}
+			return msg, nil
+		}
+		return "", errors.AIProviderError("Anthropic", fmt.Errorf("no %s tool call in the reply (stop reason %q)", commitMessageTool, anthropicResp.StopReason))
+	}
+
+	var text strings.Builder
+	for _, block := range anthropicResp.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+
+	if text.Len() == 0 {
+		return "", fmt.Errorf("no response from Anthropic")
+	}
+
+	return finishMessage(text.String(), p.prompt.body), nil
+}
+
+// StreamCommitMessage streams content_block_delta events to w.
+func (p *AnthropicProvider) StreamCommitMessage(ctx context.Context, changes *diff.Diff, w io.Writer) (string, error) {
+	resp, err := p.send(ctx, p.newRequest(changes, true))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	err = readSSE(resp.Body, func(data []byte) error {
+		var event anthropicStreamEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return fmt.Errorf("failed to decode stream event: %w", err)
+		}
+
+		switch event.Type {
+		case "content_block_delta":
+			if event.Delta.Type != "text_delta" || event.Delta.Text == "" {
+				return nil
+			}
+			text.WriteString(event.Delta.Text)
+			_, err := io.WriteString(w, event.Delta.Text)
+			return err
+		case "error":
+			return anthropicStatusError(0, data)
+		case "message_stop":
+			return errStreamDone
+		}
+		return nil
+	})
+	if err != nil {
+		return "", requestError(ctx, err)
+	}
+
+	if strings.TrimSpace(text.String()) == "" {
+		return "", fmt.Errorf("no response from Anthropic")
+	}
+
+	return finishMessage(text.String(), p.prompt.body), nil
+}
+
+// commitMessageTool names the tool that carries structured replies.
+const commitMessageTool = "commit_message"
+
+// newRequest builds a Messages API request. Like the OpenAI one it asks for
+// structured output unless streaming or the server has rejected it.
+func (p *AnthropicProvider) newRequest(changes *diff.Diff, stream bool) anthropicRequest {
+	conventions, err := loadConventions(p.prompt.conventions)
+	if err != nil {
+		conventions = "Use conventional commit format: type: description (under 50 chars)"
+	}
+
+	structured := !stream && !rejectedFormat(p.baseURL)
+
+	reqBody := anthropicRequest{
+		Model:  p.model,
+		System: conventions,
+		Messages: []chatMessage{
+			{
+				Role:    "user",
+				Content: buildPrompt(changes, p.prompt.withStructured(structured)),
+			},
+		},
+		MaxTokens:   maxTokens(p.prompt.body),
+		Temperature: p.temperature,
+		Stream:      stream,
+	}
+
+	if structured {
+		reqBody.Tools = []anthropicTool{{
+			Name:        commitMessageTool,
+			Description: "Record the commit message for the staged changes",
+			InputSchema: message.Schema(),
+		}}
+		reqBody.ToolChoice = &anthropicToolChoice{Type: "tool", Name: commitMessageTool}
+	}
+
+	return reqBody
+}
+
+// send posts a Messages API request and returns the response once it has a
+// 200 status; any other status is mapped by anthropicStatusError.
+func (p *AnthropicProvider) send(ctx context.Context, reqBody anthropicRequest) (*http.Response, error) {
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	client := p.client
+	if reqBody.Stream {
+		client = p.stream
+	}
+
+	resp, err := p.retry.do(ctx, client, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/messages", bytes.NewReader(jsonData))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("x-api-key", p.apiKey)
+		req.Header.Set("anthropic-version", anthropicVersion)
+		return req, nil
+	})
+	if err != nil {
+		return nil, requestError(ctx, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if reqBody.Tools != nil && rejectsFormat(resp.StatusCode, body) {
+			return nil, errFormatRejected
+		}
+		return nil, anthropicStatusError(resp.StatusCode, body)
+	}
+
+	return resp, nil
+}
+
+// anthropicStatusError maps a non-200 Messages API response onto the
+// UserError codes shared with the other providers.
+func anthropicStatusError(status int, body []byte) error {
+	var envelope struct {
+		Error anthropicError `json:"error"`
+	}
+	_ = json.Unmarshal(body, &envelope) // body may not be JSON
+
+	switch {
+	case status == http.StatusUnauthorized, status == http.StatusForbidden,
+		envelope.Error.Type == "authentication_error", envelope.Error.Type == "permission_error":
+		return errors.InvalidAPIKey("Anthropic")
+	case status == http.StatusTooManyRequests, envelope.Error.Type == "rate_limit_error":
+		return errors.RateLimited("Anthropic")
+	case status >= http.StatusInternalServerError, envelope.Error.Type == "overloaded_error":
+		// 529 is Anthropic's "overloaded" status
+		return errors.ServiceUnavailable("Anthropic")
+	case envelope.Error.Message != "" && status == 0:
+		// error event inside a stream, which has no status of its own
+		return errors.AIProviderError("Anthropic", fmt.Errorf("%s", envelope.Error.Message))
+	case envelope.Error.Message != "":
+		return errors.AIProviderError("Anthropic", fmt.Errorf("%s (HTTP %d)", envelope.Error.Message, status))
+	default:
+		return fmt.Errorf("Anthropic API error (HTTP %d): %s", status, string(body))
+	}
+}
@@ -0,0 +1,133 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/joaquinalmora/commitgen/internal/errors"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+)
+
+func TestAnthropicGenerateCommitMessage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/messages" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("x-api-key"); got != "test-key" {
+			t.Errorf("expected x-api-key header, got %q", got)
+		}
+		if r.Header.Get("anthropic-version") == "" {
+			t.Error("expected anthropic-version header")
+		}
+
+		var req anthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		if req.System == "" {
+			t.Error("expected top-level system prompt")
+		}
+		if len(req.Messages) != 1 || req.Messages[0].Role != "user" {
+			t.Errorf("expected a single user message, got %+v", req.Messages)
+		}
+		if len(req.Tools) != 1 || req.Tools[0].InputSchema == nil || req.ToolChoice == nil || req.ToolChoice.Name != req.Tools[0].Name {
+			t.Errorf("expected a forced tool call with the message schema, got %+v / %+v", req.Tools, req.ToolChoice)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"content":[{"type":"tool_use","id":"toolu_1","name":"commit_message","input":{"type":"feat","scope":"provider","subject":"add Anthropic provider.","body":"","breaking":false,"footers":[]}}],"stop_reason":"tool_use"}`))
+	}))
+	defer server.Close()
+
+	p, err := NewAnthropicProvider(Config{Provider: "anthropic", APIKey: "test-key", BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("NewAnthropicProvider: %v", err)
+	}
+
+	msg, err := p.GenerateCommitMessage(context.Background(), diff.FromPatch([]string{"main.go"}, "+hello"))
+	if err != nil {
+		t.Fatalf("GenerateCommitMessage: %v", err)
+	}
+	if msg != "feat(provider): add Anthropic provider" {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
+
+func TestAnthropicToolsRejected(t *testing.T) {
+	var tools []bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req anthropicRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		tools = append(tools, req.Tools != nil)
+		if req.Tools != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"type":"error","error":{"type":"invalid_request_error","message":"tools: Extra inputs are not permitted"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"content":[{"type":"text","text":"feat: add anthropic provider"}],"stop_reason":"end_turn"}`))
+	}))
+	defer server.Close()
+
+	p, err := NewAnthropicProvider(Config{APIKey: "test-key", BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("NewAnthropicProvider: %v", err)
+	}
+
+	msg, err := p.GenerateCommitMessage(context.Background(), diff.FromPatch([]string{"main.go"}, "+hello"))
+	if err != nil || msg != "feat: add anthropic provider" {
+		t.Errorf("GenerateCommitMessage() = %q, %v", msg, err)
+	}
+	if len(tools) != 2 || !tools[0] || tools[1] {
+		t.Errorf("unexpected request sequence %v", tools)
+	}
+}
+
+func TestAnthropicErrorMapping(t *testing.T) {
+	cases := []struct {
+		status int
+		body   string
+		code   int
+	}{
+		{http.StatusUnauthorized, `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`, 2},
+		{http.StatusTooManyRequests, `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`, 7},
+		{529, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`, 8},
+		{http.StatusBadRequest, `{"type":"error","error":{"type":"invalid_request_error","message":"bad model"}}`, 3},
+	}
+
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(c.status)
+			_, _ = w.Write([]byte(c.body))
+		}))
+
+		p, err := NewAnthropicProvider(Config{APIKey: "test-key", BaseURL: server.URL})
+		if err != nil {
+			t.Fatalf("NewAnthropicProvider: %v", err)
+		}
+
+		_, err = p.GenerateCommitMessage(context.Background(), diff.FromPatch([]string{"main.go"}, "+hello"))
+		server.Close()
+
+		userErr, ok := err.(errors.UserError)
+		if !ok {
+			t.Fatalf("HTTP %d: expected UserError, got %T (%v)", c.status, err, err)
+		}
+		if userErr.Code != c.code {
+			t.Errorf("HTTP %d: expected code %d, got %d", c.status, c.code, userErr.Code)
+		}
+	}
+}
+
+func TestGetProviderSelectsAnthropic(t *testing.T) {
+	p, err := GetProvider(Config{Provider: "anthropic", APIKey: "test-key"})
+	if err != nil {
+		t.Fatalf("GetProvider: %v", err)
+	}
+	if p.Name() != "anthropic" {
+		t.Errorf("expected anthropic provider, got %s", p.Name())
+	}
+}
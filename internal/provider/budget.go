@@ -0,0 +1,209 @@
+package provider
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+)
+
+// defaultTokenBudgets caps how many prompt tokens are spent on the diff, by
+// model name prefix. Hosted models get enough room for a sizeable change;
+// anything unknown is assumed to be a local model with a small default
+// context window. ai.token_budgets in commitgen.yaml overrides these.
+var defaultTokenBudgets = []struct {
+	prefix string
+	tokens int
+}{
+	{"gpt-4o", 8000},
+	{"gpt-4.1", 8000},
+	{"gpt-5", 8000},
+	{"o1", 8000},
+	{"o3", 8000},
+	{"o4", 8000},
+	{"gpt-4", 4000},
+	{"gpt-3.5", 4000},
+	{"claude", 8000},
+}
+
+const fallbackTokenBudget = 2000
+
+// TokenBudget returns the default prompt budget for model.
+func TokenBudget(model string) int {
+	m := strings.ToLower(model)
+	for _, b := range defaultTokenBudgets {
+		if strings.HasPrefix(m, b.prefix) {
+			return b.tokens
+		}
+	}
+	return fallbackTokenBudget
+}
+
+// charsPerToken approximates how many bytes of ASCII source one token
+// covers for the tokenizer family behind model.
+func charsPerToken(model string) float64 {
+	m := strings.ToLower(model)
+	switch {
+	case strings.HasPrefix(m, "gpt-4o"), strings.HasPrefix(m, "gpt-4.1"), strings.HasPrefix(m, "gpt-5"),
+		strings.HasPrefix(m, "o1"), strings.HasPrefix(m, "o3"), strings.HasPrefix(m, "o4"):
+		return 4.0 // o200k_base
+	case strings.HasPrefix(m, "gpt-"):
+		return 3.7 // cl100k_base
+	case strings.HasPrefix(m, "claude"):
+		return 3.5
+	default:
+		// Llama, Mistral and unknown models; err on the side of more tokens
+		return 3.2
+	}
+}
+
+// EstimateTokens estimates how many tokens text costs for model. ASCII is
+// charged at the model's average rate and every other character as a token
+// of its own, which overestimates slightly for most scripts.
+func EstimateTokens(text, model string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return int(math.Ceil(float64(ascii)/charsPerToken(model))) + other
+}
+
+// packDiff fits the patch into budget tokens. Every file header is kept,
+// then hunks are added round-robin across files, each file offering its
+// most informative remaining hunk, until nothing else fits. Hunks keep
+// their original order in the output, and files with changes that are not
+// shown are summarised at the end.
+func packDiff(changes *diff.Diff, budget int, model string) string {
+	patch := strings.TrimRight(changes.Patch, "\n")
+	if EstimateTokens(patch, model) <= budget && !truncated(changes) {
+		return patch
+	}
+
+	var files []diff.File
+	for _, f := range changes.Files {
+		if f.Header != "" {
+			files = append(files, f)
+		}
+	}
+	if len(files) == 0 {
+		return truncateToBudget(patch, budget, model)
+	}
+
+	remaining := budget
+	for _, f := range files {
+		remaining -= EstimateTokens(f.Header, model)
+	}
+
+	// Per file, hunk indexes from most to least informative
+	queues := make([][]int, len(files))
+	for i, f := range files {
+		order := make([]int, len(f.Hunks))
+		for j := range order {
+			order[j] = j
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return hunkScore(f.Hunks[order[a]].Text) > hunkScore(f.Hunks[order[b]].Text)
+		})
+		queues[i] = order
+	}
+
+	picked := make([]map[int]bool, len(files))
+	for i := range picked {
+		picked[i] = map[int]bool{}
+	}
+
+	for added := true; added && remaining > 0; {
+		added = false
+		for i, f := range files {
+			for len(queues[i]) > 0 {
+				j := queues[i][0]
+				queues[i] = queues[i][1:]
+				cost := EstimateTokens(f.Hunks[j].Text, model)
+				if cost <= remaining {
+					picked[i][j] = true
+					remaining -= cost
+					added = true
+					break
+				}
+				// Too big for what is left; try this file's next hunk
+			}
+		}
+	}
+
+	var out strings.Builder
+	var dropped []string
+	for i, f := range files {
+		out.WriteString(f.Header)
+		shown, plus, minus := 0, f.Added, f.Removed
+		for j, h := range f.Hunks {
+			if picked[i][j] {
+				out.WriteString(h.Text)
+				shown++
+				plus -= h.Added
+				minus -= h.Removed
+			}
+		}
+		if f.Omitted == "" && (plus > 0 || minus > 0) {
+			dropped = append(dropped, fmt.Sprintf("- %s: %d of %d hunks shown, +%d -%d lines omitted", f.Path, shown, len(f.Hunks), plus, minus))
+		}
+	}
+
+	packed := strings.TrimRight(out.String(), "\n")
+	if len(dropped) > 0 {
+		packed += "\n\nOmitted to fit the prompt budget:\n" + strings.Join(dropped, "\n")
+	}
+	return packed
+}
+
+// truncated reports whether some file has changes missing from the patch,
+// as happens when performance.patch_bytes cut it short. Files left out on
+// purpose are already marked as such in the file list.
+func truncated(changes *diff.Diff) bool {
+	for _, f := range changes.Files {
+		if f.Omitted != "" {
+			continue
+		}
+		added, removed := 0, 0
+		for _, h := range f.Hunks {
+			added += h.Added
+			removed += h.Removed
+		}
+		if added < f.Added || removed < f.Removed {
+			return true
+		}
+	}
+	return false
+}
+
+// hunkScore ranks hunks by how many changed lines carry content, so that
+// hunks consisting of blank lines or lone braces sort last.
+func hunkScore(hunk string) int {
+	score := 0
+	for _, line := range strings.Split(hunk, "\n") {
+		if !strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "-") {
+			continue
+		}
+		if strings.Trim(line[1:], " \t{}()[];,") != "" {
+			score++
+		}
+	}
+	return score
+}
+
+// truncateToBudget cuts text that is not a recognisable diff.
+func truncateToBudget(text string, budget int, model string) string {
+	limit := int(float64(budget) * charsPerToken(model))
+	out := diff.Truncate(text, limit)
+	for out != "" && EstimateTokens(out, model) > budget {
+		limit = limit * 9 / 10
+		out = diff.Truncate(text, limit)
+	}
+	return out
+}
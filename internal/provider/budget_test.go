@@ -0,0 +1,93 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	text := strings.Repeat("abcd", 100)
+	if got := EstimateTokens(text, "gpt-4o-mini"); got != 100 {
+		t.Errorf("expected 100 tokens for 400 ASCII bytes, got %d", got)
+	}
+	if EstimateTokens(text, "llama3.2") <= EstimateTokens(text, "gpt-4o-mini") {
+		t.Error("expected the local model estimate to be more conservative")
+	}
+	if got := EstimateTokens("日本語", "gpt-4o"); got != 3 {
+		t.Errorf("expected one token per non-ASCII character, got %d", got)
+	}
+}
+
+func TestTokenBudgetDefaults(t *testing.T) {
+	if TokenBudget("gpt-4o-mini") <= TokenBudget("llama3.2") {
+		t.Error("expected hosted models to get a larger default budget")
+	}
+	if got := (Config{TokenBudget: 123}).promptOptions("gpt-4o").budget; got != 123 {
+		t.Errorf("configured budget not used, got %d", got)
+	}
+}
+
+func TestPackDiffKeepsHeadersAndSummarises(t *testing.T) {
+	var patch strings.Builder
+	for _, name := range []string{"big.go", "small.go"} {
+		fmt.Fprintf(&patch, "diff --git a/%s b/%s\n--- a/%s\n+++ b/%s\n", name, name, name, name)
+		for h := 0; h < 4; h++ {
+			fmt.Fprintf(&patch, "@@ -%d +%d @@\n", h*10+1, h*10+1)
+			fmt.Fprintf(&patch, "-%s old line %d %s\n+%s new line %d %s\n", name, h, strings.Repeat("x", 200), name, h, strings.Repeat("y", 200))
+		}
+	}
+
+	packed := packDiff(diff.FromPatch(nil, patch.String()), 400, "gpt-4o")
+
+	for _, header := range []string{"+++ b/big.go", "+++ b/small.go"} {
+		if !strings.Contains(packed, header) {
+			t.Errorf("file header %q dropped", header)
+		}
+	}
+	// Round-robin: both files get a hunk before either gets a second one
+	if !strings.Contains(packed, "big.go new line") || !strings.Contains(packed, "small.go new line") {
+		t.Errorf("expected hunks from both files:\n%s", packed)
+	}
+	if !strings.Contains(packed, "Omitted to fit the prompt budget") || !strings.Contains(packed, "- small.go: 1 of 4 hunks shown, +3 -3 lines omitted") {
+		t.Errorf("expected a summary of omitted hunks:\n%s", packed)
+	}
+	if got := EstimateTokens(packed, "gpt-4o"); got > 450 {
+		t.Errorf("packed diff uses %d tokens, well over the budget", got)
+	}
+}
+
+func TestBuildPromptListsConfiguredFiles(t *testing.T) {
+	changes := diff.FromPatch([]string{"a", "b", "c", "d"}, "")
+	prompt := buildPrompt(changes, promptOptions{model: "gpt-4o", budget: 1000, maxFiles: 2})
+	if !strings.Contains(prompt, "- b (modified)\n... and 2 more files") {
+		t.Errorf("unexpected file list:\n%s", prompt)
+	}
+}
+
+func TestBuildPromptListsAPIChanges(t *testing.T) {
+	changes := diff.FromPatch([]string{"cache/cache.go"}, "")
+	changes.API = []diff.APIChange{{
+		Kind: diff.APIChanged, Decl: "func", Package: "cache", Name: "New",
+		Before: "func(string) *Cache", After: "func(string, int) *Cache", Breaking: true,
+	}}
+	prompt := buildPrompt(changes, promptOptions{model: "gpt-4o", budget: 1000, maxFiles: 10})
+	want := "- changed func New in package cache: func(string) *Cache -> func(string, int) *Cache (potentially breaking)\n"
+	if !strings.Contains(prompt, want) {
+		t.Errorf("expected API changes in the prompt:\n%s", prompt)
+	}
+}
+
+func TestBuildPromptHintsScopeAndTypes(t *testing.T) {
+	changes := diff.FromPatch([]string{"internal/cache/cache.go"}, "")
+	changes.Scope = "cache"
+	prompt := buildPrompt(changes, promptOptions{model: "gpt-4o", budget: 1000, maxFiles: 10, types: []string{"feat", "fix"}})
+
+	for _, want := range []string{"only allows these commit types: feat, fix.", "inferred from the changed paths: cache."} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("expected %q in the prompt:\n%s", want, prompt)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+)
+
+// Attempt records the outcome of one backend in a Chain. Tries counts the
+// requests sent to it, retries included.
+type Attempt struct {
+	Provider string
+	Tries    int
+	Duration time.Duration
+	Err      error
+}
+
+// Result is the outcome of Chain.Generate. Provider names the backend that
+// produced Message; Attempts lists every backend that was tried, in order.
+type Result struct {
+	Message    string
+	Candidates []string
+	Provider   string
+	Attempts   []Attempt
+}
+
+// Duration is the time spent on all attempts.
+func (r Result) Duration() time.Duration {
+	var total time.Duration
+	for _, a := range r.Attempts {
+		total += a.Duration
+	}
+	return total
+}
+
+// Chain tries an ordered list of backends until one of them answers.
+type Chain struct {
+	configs []Config
+}
+
+func NewChain(configs []Config) *Chain {
+	return &Chain{configs: configs}
+}
+
+// Configured reports whether at least one backend in the chain has the
+// credentials it needs.
+func (c *Chain) Configured() bool {
+	for _, cfg := range c.configs {
+		if cfg.APIKey != "" || !RequiresAPIKey(cfg) {
+			return true
+		}
+	}
+	return false
+}
+
+// Names returns the backend names in chain order.
+func (c *Chain) Names() []string {
+	names := make([]string, len(c.configs))
+	for i, cfg := range c.configs {
+		names[i] = cfg.Provider
+	}
+	return names
+}
+
+// generateFunc produces one or more messages from a single backend.
+type generateFunc func(ctx context.Context, p Provider) ([]string, error)
+
+// candidateTemperature makes alternative phrasings differ from each other.
+const candidateTemperature = 0.8
+
+// Generate asks each backend in turn, honouring its Timeout and Retry policy,
+// and returns the first successful message. When every backend fails the
+// returned error summarises the attempts; Result.Attempts holds the detail.
+func (c *Chain) Generate(ctx context.Context, changes *diff.Diff) (Result, error) {
+	return c.run(ctx, c.configs, func(ctx context.Context, p Provider) ([]string, error) {
+		msg, err := p.GenerateCommitMessage(ctx, changes)
+		return []string{msg}, err
+	})
+}
+
+// Stream is like Generate but writes text to w as it is produced. Backends
+// that cannot stream write their whole message once it is ready. If a
+// backend fails part-way, w may already hold its partial output.
+func (c *Chain) Stream(ctx context.Context, changes *diff.Diff, w io.Writer) (Result, error) {
+	return c.run(ctx, c.configs, func(ctx context.Context, p Provider) ([]string, error) {
+		if streamer, ok := p.(Streamer); ok {
+			msg, err := streamer.StreamCommitMessage(ctx, changes, w)
+			return []string{msg}, err
+		}
+		msg, err := p.GenerateCommitMessage(ctx, changes)
+		if err == nil {
+			_, err = io.WriteString(w, msg)
+		}
+		return []string{msg}, err
+	})
+}
+
+// Candidates asks the first working backend for up to n distinct messages,
+// using a higher temperature so they differ. Result.Candidates holds them
+// in the provider's order with duplicates removed.
+func (c *Chain) Candidates(ctx context.Context, changes *diff.Diff, n int) (Result, error) {
+	configs := make([]Config, len(c.configs))
+	for i, cfg := range c.configs {
+		if n > 1 {
+			cfg.Temperature = candidateTemperature
+		}
+		configs[i] = cfg
+	}
+
+	return c.run(ctx, configs, func(ctx context.Context, p Provider) ([]string, error) {
+		return generateCandidates(ctx, p, changes, n)
+	})
+}
+
+func (c *Chain) run(ctx context.Context, configs []Config, generate generateFunc) (Result, error) {
+	var result Result
+
+	for _, cfg := range configs {
+		attempt := Attempt{Provider: cfg.Provider}
+		start := time.Now()
+
+		var tries atomic.Int32
+		msgs, err := c.try(withTries(ctx, &tries), cfg, generate)
+		attempt.Tries = int(tries.Load())
+		attempt.Duration = time.Since(start)
+		attempt.Err = err
+		result.Attempts = append(result.Attempts, attempt)
+
+		if err == nil {
+			result.Message = msgs[0]
+			result.Candidates = msgs
+			result.Provider = cfg.Provider
+			return result, nil
+		}
+
+		if ctx.Err() != nil {
+			// The caller gave up; don't start the next backend
+			break
+		}
+	}
+
+	return result, chainError(result.Attempts)
+}
+
+func (c *Chain) try(ctx context.Context, cfg Config, generate generateFunc) ([]string, error) {
+	if cfg.APIKey == "" && RequiresAPIKey(cfg) {
+		return nil, fmt.Errorf("no API key configured")
+	}
+
+	p, err := GetProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Retries with backoff happen inside the provider's HTTP client; the
+	// timeout bounds the whole attempt including those retries.
+	attemptCtx, cancel := withTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	msgs, err := generate(attemptCtx, p)
+	if err != nil && attemptCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return nil, fmt.Errorf("timed out after %s: %w", cfg.Timeout, err)
+	}
+	if err == nil && len(msgs) == 0 {
+		return nil, fmt.Errorf("no message returned")
+	}
+	return msgs, err
+}
+
+// generateCandidates uses the provider's native multi-completion support
+// when it has one and otherwise issues n requests in parallel.
+func generateCandidates(ctx context.Context, p Provider, changes *diff.Diff, n int) ([]string, error) {
+	if cg, ok := p.(CandidateGenerator); ok {
+		msgs, err := cg.GenerateCandidates(ctx, changes, n)
+		if err != nil {
+			return nil, err
+		}
+		return Dedupe(msgs), nil
+	}
+
+	type reply struct {
+		msg string
+		err error
+	}
+	replies := make([]reply, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			msg, err := p.GenerateCommitMessage(ctx, changes)
+			replies[i] = reply{msg, err}
+		}(i)
+	}
+	wg.Wait()
+
+	var msgs []string
+	var firstErr error
+	for _, r := range replies {
+		if r.err != nil {
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			continue
+		}
+		msgs = append(msgs, r.msg)
+	}
+	if len(msgs) == 0 {
+		return nil, firstErr
+	}
+	return Dedupe(msgs), nil
+}
+
+// Dedupe drops empty messages and messages that differ from an earlier one
+// only in case or surrounding whitespace, preserving order.
+func Dedupe(msgs []string) []string {
+	seen := make(map[string]bool, len(msgs))
+	out := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		key := strings.ToLower(strings.TrimSpace(m))
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, m)
+	}
+	return out
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func chainError(attempts []Attempt) error {
+	if len(attempts) == 0 {
+		return fmt.Errorf("no AI providers configured")
+	}
+	if len(attempts) == 1 {
+		return attempts[0].Err
+	}
+
+	parts := make([]string, len(attempts))
+	for i, a := range attempts {
+		parts[i] = fmt.Sprintf("%s: %v", a.Provider, firstLine(a.Err))
+	}
+	return fmt.Errorf("all AI providers failed (%s)", strings.Join(parts, "; "))
+}
+
+func firstLine(err error) string {
+	s := err.Error()
+	if i := strings.Index(s, "\n"); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
@@ -0,0 +1,140 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+)
+
+func TestChainFallsThroughToNextProvider(t *testing.T) {
+	defer stubSleep(t)()
+
+	failing := 0
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failing++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(ollamaChatResponse{Message: chatMessage{Role: "assistant", Content: structuredReply("feat", "add chain")}, Done: true})
+	}))
+	defer up.Close()
+
+	chain := NewChain([]Config{
+		{Provider: "anthropic"}, // no key: skipped
+		{Provider: "ollama", BaseURL: down.URL, Retry: RetryPolicy{MaxRetries: 2}},
+		{Provider: "ollama", BaseURL: up.URL},
+	})
+
+	result, err := chain.Generate(context.Background(), diff.FromPatch([]string{"chain.go"}, "+chain"))
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if result.Message != "feat: add chain" {
+		t.Errorf("unexpected message %q", result.Message)
+	}
+	if len(result.Attempts) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(result.Attempts))
+	}
+	if result.Attempts[0].Err == nil || !strings.Contains(result.Attempts[0].Err.Error(), "API key") {
+		t.Errorf("expected missing key error for first backend, got %v", result.Attempts[0].Err)
+	}
+	if failing != 3 || result.Attempts[1].Tries != 3 {
+		t.Errorf("expected 3 tries against failing backend, got %d requests / %d tries", failing, result.Attempts[1].Tries)
+	}
+	if result.Attempts[0].Tries != 0 || result.Attempts[2].Tries != 1 {
+		t.Errorf("unexpected tries %d and %d", result.Attempts[0].Tries, result.Attempts[2].Tries)
+	}
+}
+
+func TestChainTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(300 * time.Millisecond):
+		}
+	}))
+	defer slow.Close()
+
+	chain := NewChain([]Config{{Provider: "ollama", BaseURL: slow.URL, Timeout: 50 * time.Millisecond}})
+
+	start := time.Now()
+	result, err := chain.Generate(context.Background(), diff.FromPatch([]string{"a.go"}, "+a"))
+	if err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if time.Since(start) > 250*time.Millisecond {
+		t.Errorf("per-provider timeout not honoured, took %s", time.Since(start))
+	}
+	if result.Provider != "" {
+		t.Errorf("expected no answering provider, got %q", result.Provider)
+	}
+}
+
+func TestChainCandidates(t *testing.T) {
+	var requests int
+	var mu sync.Mutex
+	replies := []string{structuredReply("feat", "add picker"), structuredReply("feat", "Add picker "), structuredReply("feat", "let users choose a message")}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaChatRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Options.Temperature != candidateTemperature {
+			t.Errorf("expected candidate temperature, got %v", req.Options.Temperature)
+		}
+		mu.Lock()
+		reply := replies[requests%len(replies)]
+		requests++
+		mu.Unlock()
+		_ = json.NewEncoder(w).Encode(ollamaChatResponse{Message: chatMessage{Role: "assistant", Content: reply}, Done: true})
+	}))
+	defer srv.Close()
+
+	chain := NewChain([]Config{{Provider: "ollama", BaseURL: srv.URL}})
+
+	result, err := chain.Candidates(context.Background(), diff.FromPatch([]string{"main.go"}, "+pick"), 3)
+	if err != nil {
+		t.Fatalf("Candidates: %v", err)
+	}
+	if requests != 3 {
+		t.Errorf("expected 3 requests, got %d", requests)
+	}
+	if len(result.Candidates) != 2 {
+		t.Errorf("expected duplicates to be dropped, got %q", result.Candidates)
+	}
+}
+
+func TestOpenAIGenerateCandidates(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openAIRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.N != 2 {
+			t.Errorf("expected n=2, got %d", req.N)
+		}
+		_ = json.NewEncoder(w).Encode(openAIResponse{Choices: []choice{
+			{Message: chatMessage{Content: structuredReply("fix", "one")}},
+			{Message: chatMessage{Content: structuredReply("fix", "two")}},
+		}})
+	}))
+	defer srv.Close()
+
+	p, err := NewOpenAIProvider(Config{Provider: "openai", BaseURL: srv.URL})
+	if err != nil {
+		t.Fatalf("NewOpenAIProvider: %v", err)
+	}
+
+	msgs, err := p.(CandidateGenerator).GenerateCandidates(context.Background(), diff.FromPatch([]string{"a.go"}, "+a"), 2)
+	if err != nil {
+		t.Fatalf("GenerateCandidates: %v", err)
+	}
+	if len(msgs) != 2 || msgs[0] != "fix: one" || msgs[1] != "fix: two" {
+		t.Errorf("unexpected candidates %q", msgs)
+	}
+}
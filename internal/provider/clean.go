@@ -0,0 +1,82 @@
+package provider
+
+import (
+	"strings"
+
+	"github.com/joaquinalmora/commitgen/internal/message"
+)
+
+// cleanMessage normalises raw model output into a single commit message line:
+// it strips quotes and code fences and keeps the subject within 72 characters.
+func cleanMessage(raw string) string {
+	msg := stripWrapping(raw)
+
+	if len(msg) > message.SubjectLimit {
+		msg = message.ShortenSubject(strings.Split(msg, "\n")[0])
+	}
+
+	msg = strings.TrimSpace(msg)
+	msg = trimTrailingConnector(msg)
+	if msg == "" {
+		msg = "chore: update files"
+	}
+
+	return msg
+}
+
+// cleanFullMessage normalises raw model output into a complete commit
+// message: a subject of at most 72 characters, a blank line, a body wrapped
+// at 72 columns and any trailing footers kept verbatim.
+func cleanFullMessage(raw string) string {
+	lines := strings.SplitN(stripWrapping(raw), "\n", 2)
+
+	subject := trimTrailingConnector(message.ShortenSubject(strings.TrimSpace(lines[0])))
+	if subject == "" {
+		return "chore: update files"
+	}
+	if len(lines) == 1 {
+		return subject
+	}
+
+	body := message.Wrap(lines[1], message.SubjectLimit)
+	if body == "" {
+		return subject
+	}
+	return subject + "\n\n" + body
+}
+
+// stripWrapping removes surrounding whitespace, quotes and a markdown code
+// fence from raw model output.
+func stripWrapping(raw string) string {
+	msg := strings.TrimSpace(raw)
+	msg = strings.Trim(msg, `"'`)
+
+	if strings.HasPrefix(msg, "```") {
+		lines := strings.Split(msg, "\n")
+		if len(lines) > 1 {
+			msg = strings.Join(lines[1:], "\n")
+		}
+		msg = strings.TrimSuffix(msg, "```")
+		msg = strings.TrimSpace(msg)
+	}
+
+	return strings.ReplaceAll(msg, "\r\n", "\n")
+}
+
+func trimTrailingConnector(message string) string {
+	if message == "" {
+		return message
+	}
+
+	connectors := []string{" and", " or", " but", " with", " for", " to"}
+	lower := strings.ToLower(message)
+
+	for _, connector := range connectors {
+		if strings.HasSuffix(lower, connector) {
+			message = strings.TrimSpace(message[:len(message)-len(connector)])
+			break
+		}
+	}
+
+	return strings.TrimSpace(message)
+}
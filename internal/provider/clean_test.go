@@ -0,0 +1,45 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCleanMessageKeepsOnlySubject(t *testing.T) {
+	raw := "feat: add a very long subject line that keeps going well past the limit of seventy-two\n\nBody text."
+	got := cleanMessage(raw)
+	if strings.Contains(got, "\n") || len(got) > 72 {
+		t.Errorf("expected a single line within 72 chars, got %q", got)
+	}
+}
+
+func TestCleanFullMessage(t *testing.T) {
+	raw := "```\nfeat(api): add profile image upload\n\n" +
+		"Users can now upload and update their profile pictures. Images are resized and optimised for web delivery before they are stored.\n" +
+		"- supports JPEG, PNG and WebP formats up to five megabytes in size for every user\n\n" +
+		"Closes #142\nBREAKING CHANGE: the avatar_url field was removed from the public profile response\n```"
+
+	want := "feat(api): add profile image upload\n\n" +
+		"Users can now upload and update their profile pictures. Images are\n" +
+		"resized and optimised for web delivery before they are stored.\n" +
+		"- supports JPEG, PNG and WebP formats up to five megabytes in size for\n" +
+		"  every user\n\n" +
+		"Closes #142\nBREAKING CHANGE: the avatar_url field was removed from the public profile response"
+
+	if got := cleanFullMessage(raw); got != want {
+		t.Errorf("unexpected message:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCleanFullMessageShortensOnlySubject(t *testing.T) {
+	raw := "fix: handle the case where the connection pool is exhausted during long running imports\nExplain why."
+	got := cleanFullMessage(raw)
+
+	lines := strings.Split(got, "\n")
+	if len(lines) != 3 || lines[1] != "" || lines[2] != "Explain why." {
+		t.Fatalf("expected subject, blank line and body, got %q", got)
+	}
+	if len(lines[0]) > 72 {
+		t.Errorf("subject not shortened: %q", lines[0])
+	}
+}
@@ -0,0 +1,363 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+	"github.com/joaquinalmora/commitgen/internal/errors"
+	"github.com/joaquinalmora/commitgen/internal/message"
+)
+
+const defaultOllamaURL = "http://localhost:11434"
+
+func init() {
+	Register(Factory{
+		Name:           "ollama",
+		DisplayName:    "Ollama",
+		DefaultBaseURL: defaultOllamaURL,
+		DefaultModel:   "llama3.2",
+		RequiresKey:    false,
+		New:            NewOllamaProvider,
+	})
+}
+
+// OllamaProvider talks to a local Ollama-compatible server. No API key is
+// needed and the diff never leaves the machine.
+type OllamaProvider struct {
+	model       string
+	baseURL     string
+	client      *http.Client
+	stream      *http.Client
+	retry       RetryPolicy
+	temperature float64
+	prompt      promptOptions
+}
+
+type ollamaOptions struct {
+	Temperature float64 `json:"temperature"`
+	NumPredict  int     `json:"num_predict"`
+}
+
+type ollamaChatRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+	Format   interface{}   `json:"format,omitempty"`
+	Options  ollamaOptions `json:"options"`
+}
+
+type ollamaChatResponse struct {
+	Message chatMessage `json:"message"`
+	Done    bool        `json:"done"`
+	Error   string      `json:"error,omitempty"`
+}
+
+type ollamaGenerateRequest struct {
+	Model   string        `json:"model"`
+	System  string        `json:"system,omitempty"`
+	Prompt  string        `json:"prompt"`
+	Stream  bool          `json:"stream"`
+	Format  interface{}   `json:"format,omitempty"`
+	Options ollamaOptions `json:"options"`
+}
+
+type ollamaGenerateResponse struct {
+	Response string `json:"response"`
+	Done     bool   `json:"done"`
+	Error    string `json:"error,omitempty"`
+}
+
+// errEndpointMissing signals that the server does not implement an endpoint,
+// as opposed to returning an application error from it.
+var errEndpointMissing = fmt.Errorf("endpoint not found")
+
+func NewOllamaProvider(config Config) (Provider, error) {
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = defaultOllamaURL
+	}
+
+	model := config.Model
+	if model == "" {
+		model = "llama3.2"
+	}
+
+	return &OllamaProvider{
+		model:   model,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		// Local models can take a while to load on first use
+		client:      newHTTPClient(config, 120*time.Second),
+		stream:      newStreamClient(config, 120*time.Second),
+		retry:       config.Retry,
+		temperature: config.temperature(),
+		prompt:      config.promptOptions(model),
+	}, nil
+}
+
+func (p *OllamaProvider) Name() string {
+	return "ollama"
+}
+
+func (p *OllamaProvider) IsConfigured() bool {
+	return p.baseURL != ""
+}
+
+// GenerateCommitMessage asks for output matching message.Schema through the
+// "format" field. Servers too old to support schemas reject it, after which
+// requests to them stick to plain text.
+func (p *OllamaProvider) GenerateCommitMessage(ctx context.Context, changes *diff.Diff) (string, error) {
+	conventions, err := loadConventions(p.prompt.conventions)
+	if err != nil {
+		conventions = "Use conventional commit format: type: description (under 50 chars)"
+	}
+
+	structured := !rejectedFormat(p.baseURL)
+	text, err := p.complete(ctx, conventions, changes, structured)
+	if err == errFormatRejected {
+		rememberRejection(p.baseURL)
+		structured = false
+		text, err = p.complete(ctx, conventions, changes, structured)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if strings.TrimSpace(text) == "" {
+		return "", fmt.Errorf("no response from Ollama")
+	}
+
+	if structured {
+		msg, err := finishStructured("Ollama", text, p.prompt.body)
+		if err != nil {
+			return "", errors.AIProviderError("Ollama", err)
+		}
+		return msg, nil
+	}
+	return finishMessage(text, p.prompt.body), nil
+}
+
+func (p *OllamaProvider) complete(ctx context.Context, system string, changes *diff.Diff, structured bool) (string, error) {
+	prompt := buildPrompt(changes, p.prompt.withStructured(structured))
+	options := ollamaOptions{Temperature: p.temperature, NumPredict: maxTokens(p.prompt.body)}
+
+	var format interface{}
+	if structured {
+		format = message.Schema()
+	}
+
+	text, err := p.chat(ctx, system, prompt, options, format)
+	if err == errEndpointMissing {
+		// Older servers and some Ollama-compatible proxies only expose /api/generate
+		text, err = p.generate(ctx, system, prompt, options, format)
+	}
+	return text, err
+}
+
+// StreamCommitMessage streams /api/chat, which answers with one JSON object
+// per line, copying each content fragment to w.
+func (p *OllamaProvider) StreamCommitMessage(ctx context.Context, changes *diff.Diff, w io.Writer) (string, error) {
+	conventions, err := loadConventions(p.prompt.conventions)
+	if err != nil {
+		conventions = "Use conventional commit format: type: description (under 50 chars)"
+	}
+
+	reqBody := ollamaChatRequest{
+		Model: p.model,
+		Messages: []chatMessage{
+			{Role: "system", Content: conventions},
+			{Role: "user", Content: buildPrompt(changes, p.prompt.withStructured(false))},
+		},
+		Stream:  true,
+		Options: ollamaOptions{Temperature: p.temperature, NumPredict: maxTokens(p.prompt.body)},
+	}
+
+	resp, err := p.open(ctx, "/api/chat", reqBody)
+	if err == errEndpointMissing {
+		// Streaming needs /api/chat; older servers get a single write instead
+		msg, err := p.GenerateCommitMessage(ctx, changes)
+		if err == nil {
+			_, err = io.WriteString(w, msg)
+		}
+		return msg, err
+	}
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	err = readLines(resp.Body, func(line []byte) error {
+		var chunk ollamaChatResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return fmt.Errorf("failed to decode stream chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			return errors.AIProviderError("Ollama", fmt.Errorf("%s", chunk.Error))
+		}
+		if chunk.Message.Content != "" {
+			text.WriteString(chunk.Message.Content)
+			if _, err := io.WriteString(w, chunk.Message.Content); err != nil {
+				return err
+			}
+		}
+		if chunk.Done {
+			return errStreamDone
+		}
+		return nil
+	})
+	if err != nil {
+		return "", requestError(ctx, err)
+	}
+
+	if strings.TrimSpace(text.String()) == "" {
+		return "", fmt.Errorf("no response from Ollama")
+	}
+
+	return finishMessage(text.String(), p.prompt.body), nil
+}
+
+// Ping checks that the server is reachable by listing the local models.
+func (p *OllamaProvider) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/api/tags", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected HTTP %d from %s", resp.StatusCode, p.baseURL)
+	}
+	return nil
+}
+
+func (p *OllamaProvider) chat(ctx context.Context, system, prompt string, options ollamaOptions, format interface{}) (string, error) {
+	reqBody := ollamaChatRequest{
+		Model: p.model,
+		Messages: []chatMessage{
+			{Role: "system", Content: system},
+			{Role: "user", Content: prompt},
+		},
+		Stream:  false,
+		Format:  format,
+		Options: options,
+	}
+
+	var chatResp ollamaChatResponse
+	if err := p.post(ctx, "/api/chat", reqBody, &chatResp); err != nil {
+		return "", err
+	}
+	if chatResp.Error != "" {
+		return "", errors.AIProviderError("Ollama", fmt.Errorf("%s", chatResp.Error))
+	}
+	return chatResp.Message.Content, nil
+}
+
+func (p *OllamaProvider) generate(ctx context.Context, system, prompt string, options ollamaOptions, format interface{}) (string, error) {
+	reqBody := ollamaGenerateRequest{
+		Model:   p.model,
+		System:  system,
+		Prompt:  prompt,
+		Stream:  false,
+		Format:  format,
+		Options: options,
+	}
+
+	var genResp ollamaGenerateResponse
+	if err := p.post(ctx, "/api/generate", reqBody, &genResp); err != nil {
+		return "", err
+	}
+	if genResp.Error != "" {
+		return "", errors.AIProviderError("Ollama", fmt.Errorf("%s", genResp.Error))
+	}
+	return genResp.Response, nil
+}
+
+func (p *OllamaProvider) post(ctx context.Context, path string, body interface{}, out interface{}) error {
+	resp, err := p.open(ctx, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// hasFormat reports whether a request body asks for structured output.
+func hasFormat(body interface{}) bool {
+	switch b := body.(type) {
+	case ollamaChatRequest:
+		return b.Format != nil
+	case ollamaGenerateRequest:
+		return b.Format != nil
+	}
+	return false
+}
+
+// open posts body to path and returns the response once it has a 200
+// status. errEndpointMissing is returned for a bare 404.
+func (p *OllamaProvider) open(ctx context.Context, path string, body interface{}) (*http.Response, error) {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	client := p.client
+	if chat, ok := body.(ollamaChatRequest); ok && chat.Stream {
+		client = p.stream
+	}
+
+	resp, err := p.retry.do(ctx, client, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+path, bytes.NewReader(jsonData))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errors.ProviderUnreachable("Ollama", p.baseURL, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+
+		if hasFormat(body) && rejectsFormat(resp.StatusCode, respBody) {
+			return nil, errFormatRejected
+		}
+
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Error != "" {
+			return nil, errors.AIProviderError("Ollama", fmt.Errorf("%s", apiErr.Error))
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, errEndpointMissing
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return nil, errors.ServiceUnavailable("Ollama")
+		}
+		return nil, fmt.Errorf("Ollama API error (HTTP %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	return resp, nil
+}
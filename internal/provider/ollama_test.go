@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+)
+
+func TestOllamaChat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Error("expected no Authorization header")
+		}
+		_ = json.NewEncoder(w).Encode(ollamaChatResponse{Message: chatMessage{Role: "assistant", Content: structuredReply("fix", "handle empty diff")}, Done: true})
+	}))
+	defer server.Close()
+
+	p, err := GetProvider(Config{Provider: "ollama", BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("GetProvider: %v", err)
+	}
+
+	msg, err := p.GenerateCommitMessage(context.Background(), diff.FromPatch([]string{"diff.go"}, "+if patch == \"\" {"))
+	if err != nil {
+		t.Fatalf("GenerateCommitMessage: %v", err)
+	}
+	if msg != "fix: handle empty diff" {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
+
+func TestOllamaFallsBackToGenerate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/generate":
+			_ = json.NewEncoder(w).Encode(ollamaGenerateResponse{Response: structuredReply("docs", "update README"), Done: true})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	p, err := NewOllamaProvider(Config{BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("NewOllamaProvider: %v", err)
+	}
+
+	msg, err := p.GenerateCommitMessage(context.Background(), diff.FromPatch([]string{"README.md"}, "+docs"))
+	if err != nil {
+		t.Fatalf("GenerateCommitMessage: %v", err)
+	}
+	if msg != "docs: update README" {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
+
+func TestRequiresAPIKey(t *testing.T) {
+	cases := []struct {
+		config Config
+		want   bool
+	}{
+		{Config{Provider: "openai"}, true},
+		{Config{Provider: "openai", BaseURL: "https://api.openai.com/v1/"}, true},
+		{Config{Provider: "openai", BaseURL: "http://localhost:1234/v1"}, false},
+		{Config{Provider: "anthropic"}, true},
+		{Config{Provider: "ollama"}, false},
+	}
+
+	for _, c := range cases {
+		if got := RequiresAPIKey(c.config); got != c.want {
+			t.Errorf("RequiresAPIKey(%+v) = %v, want %v", c.config, got, c.want)
+		}
+	}
+
+	if _, err := NewOpenAIProvider(Config{BaseURL: "http://localhost:1234/v1"}); err != nil {
+		t.Errorf("expected keyless OpenAI-compatible provider to be accepted, got %v", err)
+	}
+}
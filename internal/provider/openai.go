@@ -3,6 +3,7 @@ package provider
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"embed"
 	"encoding/json"
 	"fmt"
@@ -12,27 +13,48 @@ import (
 	"strings"
 	"time"
 
+	"github.com/joaquinalmora/commitgen/internal/diff"
 	"github.com/joaquinalmora/commitgen/internal/errors"
+	"github.com/joaquinalmora/commitgen/internal/message"
 )
 
 //go:embed conventions.md
 var conventionsFS embed.FS
 
 type OpenAIProvider struct {
-	apiKey  string
-	model   string
-	baseURL string
-	client  *http.Client
+	apiKey      string
+	model       string
+	baseURL     string
+	client      *http.Client
+	stream      *http.Client
+	retry       RetryPolicy
+	temperature float64
+	prompt      promptOptions
 }
 
 type openAIRequest struct {
-	Model       string    `json:"model"`
-	Messages    []message `json:"messages"`
-	MaxTokens   int       `json:"max_tokens"`
-	Temperature float64   `json:"temperature"`
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	MaxTokens   int           `json:"max_tokens"`
+	Temperature float64       `json:"temperature"`
+	N           int           `json:"n,omitempty"`
+	Stream      bool          `json:"stream,omitempty"`
+
+	ResponseFormat *openAIResponseFormat `json:"response_format,omitempty"`
 }
 
-type message struct {
+type openAIResponseFormat struct {
+	Type       string           `json:"type"`
+	JSONSchema openAIJSONSchema `json:"json_schema"`
+}
+
+type openAIJSONSchema struct {
+	Name   string                 `json:"name"`
+	Strict bool                   `json:"strict"`
+	Schema map[string]interface{} `json:"schema"`
+}
+
+type chatMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
 }
@@ -43,7 +65,14 @@ type openAIResponse struct {
 }
 
 type choice struct {
-	Message message `json:"message"`
+	Message chatMessage `json:"message"`
+}
+
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta chatMessage `json:"delta"`
+	} `json:"choices"`
+	Error *openAIError `json:"error,omitempty"`
 }
 
 type openAIError struct {
@@ -51,18 +80,32 @@ type openAIError struct {
 	Type    string `json:"type"`
 }
 
-func NewOpenAIProvider(config Config) (Provider, error) {
-	if config.APIKey == "" {
-		return nil, errors.InvalidAPIKey("OpenAI")
-	}
-
-	if !strings.HasPrefix(config.APIKey, "sk-") {
-		return nil, errors.InvalidAPIKey("OpenAI")
-	}
+const defaultOpenAIURL = "https://api.openai.com/v1"
+
+func init() {
+	Register(Factory{
+		Name:           "openai",
+		DisplayName:    "OpenAI",
+		APIKeyEnv:      "OPENAI_API_KEY",
+		DefaultBaseURL: defaultOpenAIURL,
+		DefaultModel:   "gpt-4o-mini",
+		RequiresKey:    true,
+		New:            NewOpenAIProvider,
+	})
+}
 
+func NewOpenAIProvider(config Config) (Provider, error) {
 	baseURL := config.BaseURL
 	if baseURL == "" {
-		baseURL = "https://api.openai.com/v1"
+		baseURL = defaultOpenAIURL
+	}
+
+	// Only api.openai.com itself needs an sk- key; OpenAI-compatible local
+	// servers (LM Studio, vLLM, llama.cpp) usually accept any key or none.
+	if isDefaultBaseURL(baseURL, defaultOpenAIURL) {
+		if config.APIKey == "" || !strings.HasPrefix(config.APIKey, "sk-") {
+			return nil, errors.InvalidAPIKey("OpenAI")
+		}
 	}
 
 	model := config.Model
@@ -71,12 +114,14 @@ func NewOpenAIProvider(config Config) (Provider, error) {
 	}
 
 	return &OpenAIProvider{
-		apiKey:  config.APIKey,
-		model:   model,
-		baseURL: baseURL,
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		apiKey:      config.APIKey,
+		model:       model,
+		baseURL:     baseURL,
+		client:      newHTTPClient(config, 30*time.Second),
+		stream:      newStreamClient(config, 30*time.Second),
+		retry:       config.Retry,
+		temperature: config.temperature(),
+		prompt:      config.promptOptions(model),
 	}, nil
 }
 
@@ -85,175 +130,284 @@ func (p *OpenAIProvider) Name() string {
 }
 
 func (p *OpenAIProvider) IsConfigured() bool {
-	return p.apiKey != ""
+	return p.apiKey != "" || !isDefaultBaseURL(p.baseURL, defaultOpenAIURL)
+}
+
+func (p *OpenAIProvider) GenerateCommitMessage(ctx context.Context, changes *diff.Diff) (string, error) {
+	msgs, err := p.complete(ctx, changes, 1)
+	if err != nil {
+		return "", err
+	}
+	return msgs[0], nil
+}
+
+// GenerateCandidates asks for n completions in one request using the chat
+// completions "n" parameter.
+func (p *OpenAIProvider) GenerateCandidates(ctx context.Context, changes *diff.Diff, n int) ([]string, error) {
+	return p.complete(ctx, changes, n)
 }
 
-func (p *OpenAIProvider) GenerateCommitMessage(ctx context.Context, files []string, patch string) (string, error) {
-	prompt := buildPrompt(files, patch)
+// complete sends a non-streaming request for n choices and returns one
+// finished message per choice. If the server rejects structured output the
+// request is repeated as plain text, and later requests skip it entirely.
+func (p *OpenAIProvider) complete(ctx context.Context, changes *diff.Diff, n int) ([]string, error) {
+	reqBody := p.newRequest(changes, false)
+	if n > 1 {
+		reqBody.N = n
+	}
 
-	conventions, err := loadConventions()
+	resp, err := p.send(ctx, reqBody)
+	if err == errFormatRejected {
+		rememberRejection(p.baseURL)
+		reqBody = p.newRequest(changes, false)
+		if n > 1 {
+			reqBody.N = n
+		}
+		resp, err = p.send(ctx, reqBody)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var openAIResp openAIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&openAIResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if openAIResp.Error != nil {
+		return nil, errors.AIProviderError("OpenAI", fmt.Errorf("%s", openAIResp.Error.Message))
+	}
+
+	msgs := make([]string, 0, len(openAIResp.Choices))
+	for _, c := range openAIResp.Choices {
+		if reqBody.ResponseFormat == nil {
+			msgs = append(msgs, finishMessage(c.Message.Content, p.prompt.body))
+			continue
+		}
+		msg, err := finishStructured("OpenAI", c.Message.Content, p.prompt.body)
+		if err != nil {
+			return nil, errors.AIProviderError("OpenAI", err)
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		return nil, fmt.Errorf("no response from OpenAI")
+	}
+	return msgs, nil
+}
+
+// StreamCommitMessage requests a server-sent event stream and copies each
+// content delta to w as it arrives. The returned message is the cleaned-up
+// final text.
+func (p *OpenAIProvider) StreamCommitMessage(ctx context.Context, changes *diff.Diff, w io.Writer) (string, error) {
+	resp, err := p.send(ctx, p.newRequest(changes, true))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	err = readSSE(resp.Body, func(data []byte) error {
+		if string(data) == "[DONE]" {
+			return errStreamDone
+		}
+
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("failed to decode stream chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return errors.AIProviderError("OpenAI", fmt.Errorf("%s", chunk.Error.Message))
+		}
+		for _, c := range chunk.Choices {
+			if c.Delta.Content == "" {
+				continue
+			}
+			text.WriteString(c.Delta.Content)
+			if _, err := io.WriteString(w, c.Delta.Content); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", requestError(ctx, err)
+	}
+
+	if strings.TrimSpace(text.String()) == "" {
+		return "", fmt.Errorf("no response from OpenAI")
+	}
+
+	return finishMessage(text.String(), p.prompt.body), nil
+}
+
+// newRequest builds a chat completion request. Non-streaming requests ask
+// for structured output unless the server has already rejected it; streamed
+// tokens are shown to the user, so those stay plain text.
+func (p *OpenAIProvider) newRequest(changes *diff.Diff, stream bool) openAIRequest {
+	conventions, err := loadConventions(p.prompt.conventions)
 	if err != nil {
 		conventions = "Use conventional commit format: type: description (under 50 chars)"
 	}
 
+	structured := !stream && !rejectedFormat(p.baseURL)
+
 	reqBody := openAIRequest{
 		Model: p.model,
-		Messages: []message{
+		Messages: []chatMessage{
 			{
 				Role:    "system",
 				Content: conventions,
 			},
 			{
 				Role:    "user",
-				Content: prompt,
+				Content: buildPrompt(changes, p.prompt.withStructured(structured)),
 			},
 		},
-		MaxTokens:   100,
-		Temperature: 0.1,
+		MaxTokens:   maxTokens(p.prompt.body),
+		Temperature: p.temperature,
+		Stream:      stream,
 	}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+	if structured {
+		reqBody.ResponseFormat = &openAIResponseFormat{
+			Type: "json_schema",
+			JSONSchema: openAIJSONSchema{
+				Name:   "commit_message",
+				Strict: true,
+				Schema: message.Schema(),
+			},
+		}
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+	return reqBody
+}
+
+// send posts a chat completion request and returns the response once it has
+// a 200 status; any other status is mapped to a UserError.
+func (p *OpenAIProvider) send(ctx context.Context, reqBody openAIRequest) (*http.Response, error) {
+	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	client := p.client
+	if reqBody.Stream {
+		client = p.stream
+	}
 
-	resp, err := p.client.Do(req)
+	resp, err := p.retry.do(ctx, client, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewReader(jsonData))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if reqBody.Stream {
+			req.Header.Set("Accept", "text/event-stream")
+		}
+		if p.apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+p.apiKey)
+		}
+		return req, nil
+	})
 	if err != nil {
-		return "", errors.NetworkError(err)
+		return nil, requestError(ctx, err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
 		body, _ := io.ReadAll(resp.Body)
 		switch resp.StatusCode {
 		case http.StatusUnauthorized:
-			return "", errors.InvalidAPIKey("OpenAI")
+			return nil, errors.InvalidAPIKey("OpenAI")
 		case http.StatusTooManyRequests:
-			return "", errors.UserError{
-				Message: "OpenAI API rate limit exceeded",
-				Help:    "Wait a moment and try again, or upgrade your OpenAI plan",
-				Code:    7,
-			}
+			return nil, errors.RateLimited("OpenAI")
 		case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable:
-			return "", errors.UserError{
-				Message: "OpenAI service temporarily unavailable",
-				Help:    "Try again in a few moments or use '--cached' for a previous message",
-				Code:    8,
-			}
+			return nil, errors.ServiceUnavailable("OpenAI")
 		default:
-			return "", fmt.Errorf("OpenAI API error (HTTP %d): %s", resp.StatusCode, string(body))
+			if reqBody.ResponseFormat != nil && rejectsFormat(resp.StatusCode, body) {
+				return nil, errFormatRejected
+			}
+			return nil, fmt.Errorf("OpenAI API error (HTTP %d): %s", resp.StatusCode, string(body))
 		}
 	}
 
-	var openAIResp openAIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&openAIResp); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
-	}
+	return resp, nil
+}
 
-	if openAIResp.Error != nil {
-		return "", errors.AIProviderError("OpenAI", fmt.Errorf("%s", openAIResp.Error.Message))
-	}
+// PromptVersion identifies the prompt buildPrompt writes. Bump it whenever
+// a change to the prompt or the system prompts changes the messages, so
+// that messages cached with the old prompt are regenerated.
+const PromptVersion = 1
 
-	if len(openAIResp.Choices) == 0 {
-		return "", fmt.Errorf("no response from OpenAI")
-	}
+// maxAPIChanges bounds the API changes listed in the prompt.
+const maxAPIChanges = 20
 
-	message := strings.TrimSpace(openAIResp.Choices[0].Message.Content)
-	message = strings.Trim(message, `"'`)
+func buildPrompt(changes *diff.Diff, opts promptOptions) string {
+	var prompt strings.Builder
+
+	prompt.WriteString("Analyze these code changes and generate a professional commit message:\n\n")
 
-	if strings.HasPrefix(message, "```") {
-		lines := strings.Split(message, "\n")
-		if len(lines) > 1 {
-			message = strings.Join(lines[1:], "\n")
+	prompt.WriteString("Files changed:\n")
+	for i, file := range changes.Files {
+		if i >= opts.maxFiles {
+			prompt.WriteString(fmt.Sprintf("... and %d more files\n", len(changes.Files)-opts.maxFiles))
+			break
 		}
-		message = strings.TrimSuffix(message, "```")
-		message = strings.TrimSpace(message)
+		prompt.WriteString("- " + file.Describe() + "\n")
 	}
 
-	if len(message) > 72 {
-		lines := strings.Split(message, "\n")
-		firstLine := lines[0]
-
-		if len(firstLine) > 72 {
-			words := strings.Fields(firstLine)
-			var result []string
-			length := 0
-
-			for _, word := range words {
-				if length+len(word)+1 > 72 {
-					break
-				}
-				result = append(result, word)
-				length += len(word) + 1
-			}
-
-			if len(result) > 0 {
-				truncated := strings.Join(result, " ")
-				// Check if the last word is a connector word that suggests incomplete thought
-				lastWord := strings.ToLower(result[len(result)-1])
-				if lastWord == "and" || lastWord == "or" || lastWord == "but" || lastWord == "with" || lastWord == "for" || lastWord == "to" {
-					// Remove the connector word to avoid incomplete sentences
-					if len(result) > 1 {
-						truncated = strings.Join(result[:len(result)-1], " ")
-					} else {
-						// If only connector word, fall back to character truncation
-						truncated = firstLine[:69] + "..."
-					}
-				}
-				message = truncated
-			} else {
-				message = firstLine[:69] + "..."
+	if len(changes.API) > 0 {
+		prompt.WriteString("\nExported API changes:\n")
+		for i, c := range changes.API {
+			if i >= maxAPIChanges {
+				prompt.WriteString(fmt.Sprintf("... and %d more\n", len(changes.API)-maxAPIChanges))
+				break
 			}
-		} else {
-			message = firstLine
+			prompt.WriteString("- " + c.String() + "\n")
 		}
+		prompt.WriteString("Name the most important of these in the subject, e.g. \"feat(cache): add Cache.Delete\". Treat a potentially breaking change as breaking only if callers really have to change.\n")
 	}
 
-	message = strings.TrimSpace(message)
-	message = trimTrailingConnector(message)
-	if message == "" {
-		message = "chore: update files"
+	if len(opts.types) > 0 {
+		prompt.WriteString("\nThis repository only allows these commit types: " + strings.Join(opts.types, ", ") + ".\n")
 	}
 
-	return message, nil
-}
-
-func buildPrompt(files []string, patch string) string {
-	var prompt strings.Builder
-
-	prompt.WriteString("Analyze these code changes and generate a professional commit message:\n\n")
-
-	prompt.WriteString("Files modified:\n")
-	for i, file := range files {
-		if i >= 5 {
-			prompt.WriteString(fmt.Sprintf("... and %d more files\n", len(files)-5))
-			break
-		}
-		prompt.WriteString("- " + file + "\n")
+	if changes.Scope != "" {
+		prompt.WriteString("\nSuggested scope, inferred from the changed paths: " + changes.Scope + ". Use it unless the changes clearly belong elsewhere.\n")
 	}
 
 	prompt.WriteString("\nCode changes (git diff):\n")
-	if len(patch) > 2000 {
-		prompt.WriteString(patch[:2000] + "...\n")
-	} else {
-		prompt.WriteString(patch + "\n")
+	diffAt := prompt.Len()
+
+	switch {
+	case opts.structured && opts.body:
+		prompt.WriteString("\nDescribe the change in the requested JSON fields. Use body to explain what changed and why, and footers for trailers such as \"Fixes #123\" only when they apply.")
+	case opts.structured:
+		prompt.WriteString("\nDescribe the change in the requested JSON fields. Keep the subject short and leave body and footers empty.")
+	default:
+		if opts.body {
+			prompt.WriteString("\nWrite a subject line under 72 characters, then a blank line, then a body that explains what changed and why, wrapped at 72 columns. Add footers such as \"Fixes #123\" or \"BREAKING CHANGE: ...\" after another blank line only when they apply.")
+		}
+		prompt.WriteString("\nGenerate only the commit message text. Do not include any markdown formatting, code blocks, or explanations. Return only the raw commit message.")
 	}
 
-	prompt.WriteString("\nGenerate only the commit message text. Do not include any markdown formatting, code blocks, or explanations. Return only the raw commit message.")
-
-	return prompt.String()
+	// The diff gets whatever the rest of the prompt leaves of the budget
+	text := prompt.String()
+	budget := opts.budget - EstimateTokens(text, opts.model)
+	packed := packDiff(changes, budget, opts.model)
+	return text[:diffAt] + packed + "\n" + text[diffAt:]
 }
 
-func loadConventions() (string, error) {
+// loadConventions reads the commit conventions for the system prompt from
+// COMMITGEN_CONVENTIONS_FILE, the configured file or the built-in copy, in
+// that order.
+func loadConventions(file string) (string, error) {
 	customPath := os.Getenv("COMMITGEN_CONVENTIONS_FILE")
+	if customPath == "" {
+		customPath = file
+	}
 	if customPath != "" {
 		content, err := os.ReadFile(customPath)
 		if err != nil {
@@ -269,20 +423,13 @@ func loadConventions() (string, error) {
 	return string(content), nil
 }
 
-func trimTrailingConnector(message string) string {
-	if message == "" {
-		return message
-	}
-
-	connectors := []string{" and", " or", " but", " with", " for", " to"}
-	lower := strings.ToLower(message)
-
-	for _, connector := range connectors {
-		if strings.HasSuffix(lower, connector) {
-			message = strings.TrimSpace(message[:len(message)-len(connector)])
-			break
-		}
+// ConventionsHash identifies the conventions loadConventions gives the
+// model for file, so that cached messages can be tied to them. It is empty
+// when they cannot be read.
+func ConventionsHash(file string) string {
+	content, err := loadConventions(file)
+	if err != nil {
+		return ""
 	}
-
-	return strings.TrimSpace(message)
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(content)))[:16]
 }
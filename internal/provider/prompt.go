@@ -5,7 +5,7 @@ import (
 )
 
 func GetBuiltinConventions() (string, error) {
-	return loadConventions()
+	return loadConventions("")
 }
 
 func LoadConventionsWithSource() (content string, source string, err error) {
@@ -17,7 +17,7 @@ func LoadConventionsWithSource() (content string, source string, err error) {
 		}
 	}
 
-	content, err = loadConventions()
+	content, err = loadConventions("")
 	if err != nil {
 		return "", "", err
 	}
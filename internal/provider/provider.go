@@ -3,19 +3,99 @@ package provider
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+	"github.com/joaquinalmora/commitgen/internal/errors"
 )
 
 type Provider interface {
-	GenerateCommitMessage(ctx context.Context, files []string, patch string) (string, error)
+	GenerateCommitMessage(ctx context.Context, changes *diff.Diff) (string, error)
 	Name() string
 	IsConfigured() bool
 }
 
+// Pinger is implemented by providers that can cheaply check their endpoint,
+// such as local servers that may simply not be running.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// CandidateGenerator is implemented by providers that can return several
+// alternative messages from a single request.
+type CandidateGenerator interface {
+	GenerateCandidates(ctx context.Context, changes *diff.Diff, n int) ([]string, error)
+}
+
 type Config struct {
 	Provider string
 	APIKey   string
 	Model    string
 	BaseURL  string
+	Timeout  time.Duration
+	Retry    RetryPolicy
+
+	// Temperature overrides the provider's default sampling temperature
+	// when non-zero.
+	Temperature float64
+
+	// Body asks for a full message with a body and footers instead of a
+	// single subject line.
+	Body bool
+
+	// TokenBudget caps the prompt size in estimated tokens; zero uses the
+	// model's default from TokenBudget.
+	TokenBudget int
+
+	// MaxFiles limits how many file names are listed in the prompt.
+	MaxFiles int
+
+	// ConventionsFile replaces the built-in commit conventions given to
+	// the model; COMMITGEN_CONVENTIONS_FILE takes precedence.
+	ConventionsFile string
+
+	// Types restricts the conventional-commit types the model may use.
+	Types []string
+}
+
+// promptOptions shapes the user prompt built by buildPrompt.
+type promptOptions struct {
+	model      string
+	body       bool
+	structured bool
+	budget     int
+	maxFiles   int
+	types      []string
+	// conventions is the file with the system prompt, empty for the
+	// built-in one
+	conventions string
+}
+
+// withStructured returns a copy of o that asks for structured output or not.
+func (o promptOptions) withStructured(structured bool) promptOptions {
+	o.structured = structured
+	return o
+}
+
+func (c Config) promptOptions(model string) promptOptions {
+	opts := promptOptions{
+		model:    model,
+		body:     c.Body,
+		budget:   c.TokenBudget,
+		maxFiles: c.MaxFiles,
+		types:    c.Types,
+
+		conventions: c.ConventionsFile,
+	}
+	if opts.budget <= 0 {
+		opts.budget = TokenBudget(model)
+	}
+	if opts.maxFiles <= 0 {
+		opts.maxFiles = 10
+	}
+	return opts
 }
 
 type ProviderError struct {
@@ -28,6 +108,87 @@ func (e *ProviderError) Error() string {
 }
 
 func GetProvider(config Config) (Provider, error) {
-	// Only support OpenAI provider
-	return NewOpenAIProvider(config)
+	name := config.Provider
+	if name == "" {
+		name = "openai"
+	}
+
+	f, ok := Lookup(name)
+	if !ok {
+		return nil, errors.ConfigError("ai.provider", config.Provider)
+	}
+	return f.New(config)
+}
+
+// RequiresAPIKey reports whether the configured backend needs an API key.
+// Keyless backends such as Ollama never do, and neither does an
+// OpenAI-compatible server on a custom base URL.
+func RequiresAPIKey(config Config) bool {
+	name := config.Provider
+	if name == "" {
+		name = "openai"
+	}
+
+	f, ok := Lookup(name)
+	if !ok {
+		return true
+	}
+	if !f.RequiresKey {
+		return false
+	}
+	if f.Name == "openai" {
+		return isDefaultBaseURL(config.BaseURL, f.DefaultBaseURL)
+	}
+	return true
+}
+
+func isDefaultBaseURL(baseURL, defaultURL string) bool {
+	return baseURL == "" || strings.TrimSuffix(baseURL, "/") == strings.TrimSuffix(defaultURL, "/")
+}
+
+// newHTTPClient returns a client whose timeout is the configured one, or
+// fallback when none was set.
+func newHTTPClient(config Config, fallback time.Duration) *http.Client {
+	return &http.Client{Timeout: requestTimeout(config, fallback)}
+}
+
+// newStreamClient returns a client for streamed responses. The timeout
+// only bounds the wait for the response headers, as reading the body lasts
+// as long as the model keeps generating; the context bounds the rest.
+func newStreamClient(config Config, fallback time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = requestTimeout(config, fallback)
+	return &http.Client{Transport: transport}
+}
+
+func requestTimeout(config Config, fallback time.Duration) time.Duration {
+	if config.Timeout > 0 {
+		return config.Timeout
+	}
+	return fallback
+}
+
+// maxTokens leaves room for a body and footers when they are requested.
+func maxTokens(body bool) int {
+	if body {
+		return 400
+	}
+	return 100
+}
+
+// finishMessage cleans raw model output into the requested message shape.
+func finishMessage(raw string, body bool) string {
+	if body {
+		return cleanFullMessage(raw)
+	}
+	return cleanMessage(raw)
+}
+
+// temperature returns the configured sampling temperature, defaulting to a
+// low value so commit messages stay consistent between runs.
+func (c Config) temperature() float64 {
+	if c.Temperature > 0 {
+		return c.Temperature
+	}
+	return 0.1
 }
@@ -0,0 +1,81 @@
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Factory describes a provider backend: how to construct it and which
+// configuration it expects. Backends register a Factory from init so that
+// config loading, doctor and init can discover them by name.
+type Factory struct {
+	Name           string
+	DisplayName    string
+	APIKeyEnv      string
+	DefaultBaseURL string
+	DefaultModel   string
+	RequiresKey    bool
+	New            func(Config) (Provider, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register adds a backend to the registry. It panics if the name is empty,
+// New is nil or the name is already taken, mirroring database/sql.Register.
+func Register(f Factory) {
+	name := strings.ToLower(f.Name)
+	if name == "" || f.New == nil {
+		panic("provider: Register requires a name and a constructor")
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, dup := registry[name]; dup {
+		panic(fmt.Sprintf("provider: Register called twice for %q", name))
+	}
+	f.Name = name
+	if f.DisplayName == "" {
+		f.DisplayName = name
+	}
+	registry[name] = f
+}
+
+// Lookup returns the factory registered under name.
+func Lookup(name string) (Factory, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	f, ok := registry[strings.ToLower(name)]
+	return f, ok
+}
+
+// Registered returns all registered factories sorted by name.
+func Registered() []Factory {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	factories := make([]Factory, 0, len(registry))
+	for _, f := range registry {
+		factories = append(factories, f)
+	}
+	sort.Slice(factories, func(i, j int) bool {
+		return factories[i].Name < factories[j].Name
+	})
+	return factories
+}
+
+// Names returns the names of all registered providers, sorted.
+func Names() []string {
+	factories := Registered()
+	names := make([]string, len(factories))
+	for i, f := range factories {
+		names[i] = f.Name
+	}
+	return names
+}
@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+)
+
+type stubProvider struct{ name string }
+
+func (s stubProvider) GenerateCommitMessage(ctx context.Context, changes *diff.Diff) (string, error) {
+	return "chore: stub", nil
+}
+
+func (s stubProvider) Name() string       { return s.name }
+func (s stubProvider) IsConfigured() bool { return true }
+
+func TestRegistryBuiltins(t *testing.T) {
+	for _, name := range []string{"openai", "anthropic", "ollama"} {
+		f, ok := Lookup(name)
+		if !ok {
+			t.Fatalf("expected %s to be registered", name)
+		}
+		if f.DefaultModel == "" || f.DefaultBaseURL == "" {
+			t.Errorf("%s: expected default model and base URL, got %+v", name, f)
+		}
+		if f.RequiresKey != (f.APIKeyEnv != "") {
+			t.Errorf("%s: RequiresKey=%v but APIKeyEnv=%q", name, f.RequiresKey, f.APIKeyEnv)
+		}
+	}
+}
+
+func TestRegisterCustomProvider(t *testing.T) {
+	if _, ok := Lookup("stub-test"); !ok {
+		Register(Factory{
+			Name: "Stub-Test",
+			New: func(config Config) (Provider, error) {
+				return stubProvider{name: "stub-test"}, nil
+			},
+		})
+	}
+
+	p, err := GetProvider(Config{Provider: "stub-test"})
+	if err != nil {
+		t.Fatalf("GetProvider: %v", err)
+	}
+	if p.Name() != "stub-test" {
+		t.Errorf("unexpected provider %q", p.Name())
+	}
+	if RequiresAPIKey(Config{Provider: "stub-test"}) {
+		t.Error("expected stub provider not to require a key")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected duplicate Register to panic")
+		}
+	}()
+	Register(Factory{Name: "stub-test", New: func(Config) (Provider, error) { return nil, nil }})
+}
+
+func TestGetProviderUnknown(t *testing.T) {
+	if _, err := GetProvider(Config{Provider: "does-not-exist"}); err == nil {
+		t.Error("expected error for unknown provider")
+	}
+}
@@ -0,0 +1,171 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// RetryPolicy controls how requests to a provider are retried after rate
+// limiting, 5xx responses and network errors.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// DefaultRetryPolicy is used when no performance.* retry settings are given.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 2,
+	BaseDelay:  500 * time.Millisecond,
+	MaxDelay:   10 * time.Second,
+}
+
+// sleep is replaced in tests to avoid real waiting.
+var sleep = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// triesKey is the context key under which a Chain asks do to count the
+// requests it sends.
+type triesKey struct{}
+
+// withTries returns a context in which do adds every request it sends,
+// retries included, to n.
+func withTries(ctx context.Context, n *atomic.Int32) context.Context {
+	return context.WithValue(ctx, triesKey{}, n)
+}
+
+// do sends the request built by newRequest, retrying with jittered
+// exponential backoff while the response is retryable. Server hints in
+// Retry-After and x-ratelimit-reset-* take precedence over the computed
+// backoff, but a hint longer than MaxDelay ends the retries rather than
+// stalling the caller for minutes. It never sleeps past the context
+// deadline either: when the next wait would overrun it, the last response
+// or error is returned instead.
+func (p RetryPolicy) do(ctx context.Context, client *http.Client, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		if n, ok := ctx.Value(triesKey{}).(*atomic.Int32); ok {
+			n.Add(1)
+		}
+		resp, err := client.Do(req)
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, ctx.Err()
+		}
+		if attempt >= p.MaxRetries {
+			return resp, err
+		}
+
+		delay := p.backoff(attempt)
+		if resp != nil {
+			if hint, ok := retryAfter(resp.Header, time.Now()); ok {
+				if hint > p.maxDelay() {
+					return resp, err
+				}
+				delay = hint
+			}
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return resp, err
+		}
+
+		if resp != nil {
+			// Drain so the connection can be reused
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoff returns a delay in [d/2, d) where d doubles with every attempt
+// and is capped at MaxDelay.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	base := p.BaseDelay
+	if base <= 0 {
+		base = DefaultRetryPolicy.BaseDelay
+	}
+	maxDelay := p.maxDelay()
+
+	d := base << uint(attempt)
+	if d <= 0 || d > maxDelay {
+		d = maxDelay
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func (p RetryPolicy) maxDelay() time.Duration {
+	if p.MaxDelay <= 0 {
+		return DefaultRetryPolicy.MaxDelay
+	}
+	return p.MaxDelay
+}
+
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+		529: // Anthropic "overloaded"
+		return true
+	}
+	return false
+}
+
+// retryAfter reads the server's requested wait from Retry-After (seconds or
+// HTTP date) or OpenAI's x-ratelimit-reset-requests/-tokens durations such
+// as "1s" or "6m0s". The longest hint wins.
+func retryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	var best time.Duration
+	found := false
+
+	if v := strings.TrimSpace(h.Get("Retry-After")); v != "" {
+		if secs, err := strconv.ParseFloat(v, 64); err == nil && secs >= 0 {
+			best, found = time.Duration(secs*float64(time.Second)), true
+		} else if t, err := http.ParseTime(v); err == nil {
+			best, found = max(t.Sub(now), 0), true
+		}
+	}
+
+	for _, name := range []string{"x-ratelimit-reset-requests", "x-ratelimit-reset-tokens"} {
+		v := strings.TrimSpace(h.Get(name))
+		if v == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(v); err == nil && (!found || d > best) {
+			best, found = d, true
+		}
+	}
+
+	return best, found
+}
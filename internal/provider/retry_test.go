@@ -0,0 +1,174 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/joaquinalmora/commitgen/internal/errors"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+)
+
+// stubSleep records requested delays instead of sleeping and returns a
+// function restoring the real implementation.
+func stubSleep(t *testing.T) func() {
+	t.Helper()
+	original := sleep
+	sleep = func(ctx context.Context, d time.Duration) error {
+		return ctx.Err()
+	}
+	return func() { sleep = original }
+}
+
+func TestOpenAIRetriesRateLimit(t *testing.T) {
+	var delays []time.Duration
+	original := sleep
+	sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	defer func() { sleep = original }()
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.Header().Set("x-ratelimit-reset-requests", "1.5s")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 3:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			_ = json.NewEncoder(w).Encode(openAIResponse{Choices: []choice{{Message: chatMessage{Role: "assistant", Content: structuredReply("fix", "retry rate limits")}}}})
+		}
+	}))
+	defer server.Close()
+
+	p, err := NewOpenAIProvider(Config{
+		BaseURL: server.URL,
+		Retry:   RetryPolicy{MaxRetries: 3, BaseDelay: 10 * time.Millisecond, MaxDelay: 5 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("NewOpenAIProvider: %v", err)
+	}
+
+	msg, err := p.GenerateCommitMessage(context.Background(), diff.FromPatch([]string{"openai.go"}, "+retry"))
+	if err != nil {
+		t.Fatalf("GenerateCommitMessage: %v", err)
+	}
+	if msg != "fix: retry rate limits" {
+		t.Errorf("unexpected message %q", msg)
+	}
+	if calls != 4 {
+		t.Fatalf("expected 4 requests, got %d", calls)
+	}
+	if delays[0] != 2*time.Second || delays[1] != 1500*time.Millisecond {
+		t.Errorf("expected server hints to be honoured, got %v", delays)
+	}
+	if delays[2] < 20*time.Millisecond || delays[2] > 40*time.Millisecond {
+		t.Errorf("expected jittered third backoff in [20ms,40ms], got %v", delays[2])
+	}
+}
+
+func TestOpenAIRetryBudgetExhausted(t *testing.T) {
+	defer stubSleep(t)()
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	p, _ := NewOpenAIProvider(Config{BaseURL: server.URL, Retry: RetryPolicy{MaxRetries: 2}})
+	_, err := p.GenerateCommitMessage(context.Background(), diff.FromPatch([]string{"a.go"}, "+a"))
+
+	userErr, ok := err.(errors.UserError)
+	if !ok || userErr.Code != 7 {
+		t.Fatalf("expected rate limit UserError, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 1 request plus 2 retries, got %d", calls)
+	}
+}
+
+func TestRetryGivesUpOnLongHint(t *testing.T) {
+	var delays []time.Duration
+	original := sleep
+	sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	defer func() { sleep = original }()
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("x-ratelimit-reset-tokens", "6m0s")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	// No deadline on the context: only MaxDelay stops a six minute wait
+	p, _ := NewOpenAIProvider(Config{BaseURL: server.URL, Retry: RetryPolicy{MaxRetries: 3, MaxDelay: 10 * time.Second}})
+	_, err := p.GenerateCommitMessage(context.Background(), diff.FromPatch([]string{"a.go"}, "+a"))
+
+	if userErr, ok := err.(errors.UserError); !ok || userErr.Code != 7 {
+		t.Fatalf("expected rate limit UserError, got %v", err)
+	}
+	if calls != 1 || len(delays) != 0 {
+		t.Errorf("expected no retry after a hint beyond MaxDelay, got %d calls and waits %v", calls, delays)
+	}
+}
+
+func TestRetryRespectsDeadline(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	p, _ := NewOpenAIProvider(Config{BaseURL: server.URL, Retry: RetryPolicy{MaxRetries: 5}})
+	start := time.Now()
+	_, err := p.GenerateCommitMessage(ctx, diff.FromPatch([]string{"a.go"}, "+a"))
+
+	if userErr, ok := err.(errors.UserError); !ok || userErr.Code != 8 {
+		t.Fatalf("expected service unavailable UserError, got %v", err)
+	}
+	if calls != 1 || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("expected no retry past the deadline, got %d calls in %s", calls, time.Since(start))
+	}
+}
+
+func TestRetryAfterParsing(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	h := http.Header{}
+	h.Set("Retry-After", now.Add(3*time.Second).Format(http.TimeFormat))
+	if d, ok := retryAfter(h, now); !ok || d != 3*time.Second {
+		t.Errorf("HTTP-date Retry-After: got %v, %v", d, ok)
+	}
+
+	h = http.Header{}
+	h.Set("x-ratelimit-reset-requests", "200ms")
+	h.Set("x-ratelimit-reset-tokens", "6m0s")
+	if d, ok := retryAfter(h, now); !ok || d != 6*time.Minute {
+		t.Errorf("expected longest reset hint, got %v, %v", d, ok)
+	}
+
+	if _, ok := retryAfter(http.Header{}, now); ok {
+		t.Error("expected no hint without headers")
+	}
+}
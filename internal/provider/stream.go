@@ -0,0 +1,69 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+	"github.com/joaquinalmora/commitgen/internal/errors"
+)
+
+// Streamer is implemented by providers that can emit the message while it
+// is being generated. Text is written to w as it arrives; the returned
+// string has gone through the same clean-up as GenerateCommitMessage.
+type Streamer interface {
+	StreamCommitMessage(ctx context.Context, changes *diff.Diff, w io.Writer) (string, error)
+}
+
+// errStreamDone is returned by stream callbacks to stop reading early once
+// the server has signalled the end of the stream.
+var errStreamDone = fmt.Errorf("stream done")
+
+// readSSE calls fn with the payload of every "data:" line of a server-sent
+// event stream. Comments, event names and blank lines are skipped.
+func readSSE(r io.Reader, fn func(data []byte) error) error {
+	return readLines(r, func(line []byte) error {
+		data, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			return nil
+		}
+		return fn(bytes.TrimSpace(data))
+	})
+}
+
+// readLines calls fn for each non-empty line, as used by newline-delimited
+// JSON streams. A callback returning errStreamDone ends reading cleanly.
+func readLines(r io.Reader, fn func(line []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := fn(line); err != nil {
+			if err == errStreamDone {
+				return nil
+			}
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// requestError turns a transport failure or a failure while reading a
+// stream into a UserError. Cancellation (Ctrl-C) is passed through untouched
+// so callers can tell it apart from a provider failure.
+func requestError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if _, ok := err.(errors.UserError); ok {
+		return err
+	}
+	return errors.NetworkError(err)
+}
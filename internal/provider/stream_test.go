@@ -0,0 +1,111 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+)
+
+func TestOpenAIStreamCommitMessage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openAIRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			t.Error("expected stream:true in request")
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, token := range []string{"```\\n", "feat: ", "stream ", "tokens", "\\n```"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":\"%s\"}}]}\n\n", token)
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	p, err := NewOpenAIProvider(Config{BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("NewOpenAIProvider: %v", err)
+	}
+
+	var out strings.Builder
+	msg, err := p.(Streamer).StreamCommitMessage(context.Background(), diff.FromPatch([]string{"a.go"}, "+a"), &out)
+	if err != nil {
+		t.Fatalf("StreamCommitMessage: %v", err)
+	}
+	if out.String() != "```\nfeat: stream tokens\n```" {
+		t.Errorf("expected raw tokens to be streamed, got %q", out.String())
+	}
+	if msg != "feat: stream tokens" {
+		t.Errorf("expected fences stripped from final message, got %q", msg)
+	}
+}
+
+func TestStreamOutlivesRequestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, token := range []string{"feat: ", "slow ", "stream"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":\"%s\"}}]}\n\n", token)
+			w.(http.Flusher).Flush()
+			time.Sleep(60 * time.Millisecond)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	// The timeout covers the wait for headers, not the whole stream
+	p, _ := NewOpenAIProvider(Config{BaseURL: server.URL, Timeout: 100 * time.Millisecond})
+	var out strings.Builder
+	msg, err := p.(Streamer).StreamCommitMessage(context.Background(), diff.FromPatch([]string{"a.go"}, "+a"), &out)
+	if err != nil || msg != "feat: slow stream" {
+		t.Errorf("StreamCommitMessage() = %q, %v", msg, err)
+	}
+}
+
+func TestStreamCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"feat: \"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		cancel()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	chain := NewChain([]Config{{Provider: "openai", BaseURL: server.URL}})
+
+	var out strings.Builder
+	_, err := chain.Stream(ctx, diff.FromPatch([]string{"a.go"}, "+a"), &out)
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestChainStreamWritesNonStreamingResult(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/chat" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(ollamaGenerateResponse{Response: structuredReply("chore", "tidy"), Done: true})
+	}))
+	defer server.Close()
+
+	chain := NewChain([]Config{{Provider: "ollama", BaseURL: server.URL}})
+
+	var out strings.Builder
+	result, err := chain.Stream(context.Background(), diff.FromPatch([]string{"a.go"}, "+a"), &out)
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	if out.String() != "chore: tidy" || result.Message != "chore: tidy" {
+		t.Errorf("unexpected output %q / message %q", out.String(), result.Message)
+	}
+}
@@ -0,0 +1,57 @@
+package provider
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/joaquinalmora/commitgen/internal/message"
+)
+
+// errFormatRejected signals that the backend refused a structured-output
+// request, so it should be repeated as plain text.
+var errFormatRejected = fmt.Errorf("structured output not supported")
+
+// textOnly holds the base URLs of servers that have rejected structured
+// output. It is kept here rather than on the providers, which a Chain
+// builds afresh for every call, so that each server is only asked once.
+var textOnly sync.Map
+
+func rejectedFormat(baseURL string) bool {
+	_, ok := textOnly.Load(baseURL)
+	return ok
+}
+
+func rememberRejection(baseURL string) {
+	textOnly.Store(baseURL, true)
+}
+
+// rejectsFormat reports whether an error response to a structured-output
+// request is about the requested format, schema or tool rather than
+// anything else.
+func rejectsFormat(status int, body []byte) bool {
+	if status != http.StatusBadRequest && status != http.StatusUnprocessableEntity {
+		return false
+	}
+	lower := bytes.ToLower(body)
+	for _, word := range []string{"format", "schema", "tool"} {
+		if bytes.Contains(lower, []byte(word)) {
+			return true
+		}
+	}
+	return false
+}
+
+// finishStructured assembles a commit message from a reply produced against
+// message.Schema. A reply that is not valid JSON, such as one cut off at
+// the token limit, is an error like any other invalid reply: plain text is
+// only accepted from servers that rejected the schema outright.
+func finishStructured(provider, raw string, body bool) (string, error) {
+	m, err := message.Decode([]byte(strings.TrimSpace(raw)))
+	if err != nil {
+		return "", fmt.Errorf("%s returned an invalid commit message: %w", provider, err)
+	}
+	return m.String(body), nil
+}
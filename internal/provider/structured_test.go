@@ -0,0 +1,121 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+	"github.com/joaquinalmora/commitgen/internal/message"
+)
+
+// structuredReply is what a backend answers a message.Schema request with
+// for a message without scope or body.
+func structuredReply(typ, subject string) string {
+	data, _ := json.Marshal(message.Message{Type: typ, Subject: subject, Footers: []string{}})
+	return string(data)
+}
+
+func TestOpenAIStructuredOutput(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openAIRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.ResponseFormat == nil || req.ResponseFormat.Type != "json_schema" || !req.ResponseFormat.JSONSchema.Strict {
+			t.Errorf("expected a strict json_schema response format, got %+v", req.ResponseFormat)
+		}
+		content := `{"type":"fix","scope":"cache","subject":"expire stale entries","body":"Entries older than the TTL were returned.","breaking":false,"footers":["Fixes #7"]}`
+		_ = json.NewEncoder(w).Encode(openAIResponse{Choices: []choice{{Message: chatMessage{Role: "assistant", Content: content}}}})
+	}))
+	defer server.Close()
+
+	p, err := NewOpenAIProvider(Config{BaseURL: server.URL, Body: true})
+	if err != nil {
+		t.Fatalf("NewOpenAIProvider: %v", err)
+	}
+
+	msg, err := p.GenerateCommitMessage(context.Background(), diff.FromPatch([]string{"cache.go"}, "+ttl"))
+	if err != nil {
+		t.Fatalf("GenerateCommitMessage: %v", err)
+	}
+	want := "fix(cache): expire stale entries\n\nEntries older than the TTL were returned.\n\nFixes #7"
+	if msg != want {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
+
+func TestOpenAIStructuredOutputRejected(t *testing.T) {
+	var formats []bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openAIRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		formats = append(formats, req.ResponseFormat != nil)
+		if req.ResponseFormat != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":{"message":"response_format is not supported","type":"invalid_request_error"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"\"docs: fix typo\""}}]}`))
+	}))
+	defer server.Close()
+
+	// A Chain builds a new provider for every call
+	for i := 0; i < 2; i++ {
+		p, err := NewOpenAIProvider(Config{BaseURL: server.URL})
+		if err != nil {
+			t.Fatalf("NewOpenAIProvider: %v", err)
+		}
+		msg, err := p.GenerateCommitMessage(context.Background(), diff.FromPatch([]string{"README.md"}, "+typo"))
+		if err != nil {
+			t.Fatalf("GenerateCommitMessage: %v", err)
+		}
+		if msg != "docs: fix typo" {
+			t.Errorf("unexpected message %q", msg)
+		}
+	}
+
+	// One rejected structured request, then plain text only
+	if len(formats) != 3 || !formats[0] || formats[1] || formats[2] {
+		t.Errorf("unexpected request sequence %v", formats)
+	}
+}
+
+func TestOpenAIStructuredOutputTruncated(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Cut off at max_tokens
+		content := `{"type":"feat","subj`
+		_ = json.NewEncoder(w).Encode(openAIResponse{Choices: []choice{{Message: chatMessage{Role: "assistant", Content: content}}}})
+	}))
+	defer server.Close()
+
+	p, err := NewOpenAIProvider(Config{BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("NewOpenAIProvider: %v", err)
+	}
+
+	if msg, err := p.GenerateCommitMessage(context.Background(), diff.FromPatch([]string{"a.go"}, "+a")); err == nil {
+		t.Fatalf("expected an error for a truncated reply, got %q", msg)
+	}
+}
+
+func TestOllamaStructuredOutputInvalid(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaChatRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Format == nil {
+			t.Error("expected a format schema")
+		}
+		_, _ = w.Write([]byte(`{"message":{"role":"assistant","content":"{\"type\":\"update\",\"scope\":\"\",\"subject\":\"things\",\"body\":\"\",\"breaking\":false,\"footers\":[]}"},"done":true}`))
+	}))
+	defer server.Close()
+
+	p, err := NewOllamaProvider(Config{BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("NewOllamaProvider: %v", err)
+	}
+
+	if _, err := p.GenerateCommitMessage(context.Background(), diff.FromPatch([]string{"a.go"}, "+a")); err == nil {
+		t.Fatal("expected an error for an unknown commit type")
+	}
+}
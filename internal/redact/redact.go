@@ -0,0 +1,325 @@
+// Package redact removes secrets from a diff before it is sent to a model.
+package redact
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+)
+
+// Finding is one redacted secret. The secret itself is never kept.
+type Finding struct {
+	Path string
+	// Line is the line number in the new file, or in the old file when
+	// Removed is set.
+	Line    int
+	Removed bool
+	Kind    string
+}
+
+func (f Finding) String() string {
+	side := ""
+	if f.Removed {
+		side = " (removed line)"
+	}
+	return fmt.Sprintf("%s:%d: %s%s", f.Path, f.Line, f.Kind, side)
+}
+
+// Placeholder is what a secret of the given kind is replaced with.
+func Placeholder(kind string) string {
+	return "<redacted:" + kind + ">"
+}
+
+type pattern struct {
+	kind string
+	re   *regexp.Regexp
+}
+
+// patterns are well-known credential formats, checked before the generic
+// assignment and entropy rules.
+var patterns = []pattern{
+	{"aws-access-key", regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[0-9A-Z]{16}\b`)},
+	{"github-token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"slack-token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{"slack-webhook", regexp.MustCompile(`https://hooks\.slack\.com/services/[A-Za-z0-9/_-]+`)},
+	{"api-key", regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`)},
+}
+
+var (
+	pemBegin = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)
+	pemEnd   = regexp.MustCompile(`-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)
+	pemBlock = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----.*?-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)
+
+	// envLine is a KEY=value line as found in .env files, optionally
+	// exported
+	envLine = regexp.MustCompile(`^(\s*(?:export\s+)?[A-Za-z_][A-Za-z0-9_.-]*\s*=\s*)(.+)$`)
+
+	// secretAssignment is an assignment to a secret-looking name in any
+	// language or config format, e.g. password: "hunter22" or
+	// API_KEY = 'abc123...'
+	secretAssignment = regexp.MustCompile(`(?i)((?:[a-z0-9_.-]*(?:secret|token|passw(?:or)?d|api[_-]?key|access[_-]?key|private[_-]?key|credentials?)[a-z0-9_.-]*)["']?\s*(?::=|=|:)\s*)(["']?)([^\s"',;]{8,})(["']?)`)
+
+	// candidate is a run of characters long enough to be an encoded key
+	candidate = regexp.MustCompile(`[A-Za-z0-9+/_=-]{24,}`)
+)
+
+// entropyThreshold is the Shannon entropy, in bits per character, above
+// which a mixed-case alphanumeric token is treated as a secret, provided it
+// changes character class at least switchRatio times per character.
+const (
+	entropyThreshold = 4.0
+	switchRatio      = 0.4
+)
+
+// Diff returns a copy of changes with secrets in its hunks replaced by
+// placeholders, and where they were found. changes is not modified.
+func Diff(changes *diff.Diff) (*diff.Diff, []Finding) {
+	out := *changes
+	out.Files = make([]diff.File, len(changes.Files))
+	var findings []Finding
+	var patch strings.Builder
+
+	for i, f := range changes.Files {
+		env := isEnvFile(f.Path)
+		if len(f.Hunks) > 0 {
+			hunks := make([]diff.Hunk, len(f.Hunks))
+			for j, h := range f.Hunks {
+				var found []Finding
+				h.Text, found = redactHunk(f.Path, h, env)
+				hunks[j] = h
+				findings = append(findings, found...)
+			}
+			f.Hunks = hunks
+		}
+		out.Files[i] = f
+		patch.WriteString(f.String())
+	}
+
+	if len(findings) == 0 {
+		return changes, nil
+	}
+	out.Patch = patch.String()
+	return &out, findings
+}
+
+// redactHunk scrubs one hunk line by line, tracking line numbers on both
+// sides and whether a private key block is open.
+func redactHunk(filePath string, h diff.Hunk, env bool) (string, []Finding) {
+	var findings []Finding
+	lines := strings.SplitAfter(h.Text, "\n")
+	oldLine, newLine := h.OldStart, h.NewStart
+	inKey := false
+
+	for i, line := range lines {
+		if i == 0 || line == "" || line[0] == '\\' {
+			// The "@@" line and "\ No newline at end of file"
+			continue
+		}
+
+		finding := Finding{Path: filePath, Line: newLine}
+		switch line[0] {
+		case '+':
+			newLine++
+		case '-':
+			finding.Line, finding.Removed = oldLine, true
+			oldLine++
+		default:
+			oldLine++
+			newLine++
+		}
+
+		body := strings.TrimRight(line[1:], "\r\n")
+		eol := line[1+len(body):]
+
+		var kinds []string
+		switch {
+		case inKey:
+			if pemEnd.MatchString(body) {
+				inKey = false
+			} else {
+				body = Placeholder("private-key")
+			}
+		case pemBegin.MatchString(body):
+			kinds = append(kinds, "private-key")
+			if pemEnd.MatchString(body) {
+				// A whole key in one string literal
+				body = pemBlock.ReplaceAllString(body, Placeholder("private-key"))
+			} else {
+				inKey = true
+			}
+		default:
+			body, kinds = Line(body, env)
+		}
+
+		lines[i] = line[:1] + body + eol
+		for _, kind := range kinds {
+			finding.Kind = kind
+			findings = append(findings, finding)
+		}
+	}
+
+	return strings.Join(lines, ""), findings
+}
+
+// Line redacts secrets in a single line of text and returns the kinds of
+// secret replaced. With env set the line is read as a .env assignment, whose
+// whole value is treated as secret.
+func Line(line string, env bool) (string, []string) {
+	var kinds []string
+
+	for _, p := range patterns {
+		if p.re.MatchString(line) {
+			line = p.re.ReplaceAllString(line, Placeholder(p.kind))
+			kinds = append(kinds, p.kind)
+		}
+	}
+
+	if env && !strings.HasPrefix(strings.TrimSpace(line), "#") {
+		if m := envLine.FindStringSubmatch(line); m != nil && !isPlaceholderValue(m[2]) {
+			line = m[1] + Placeholder("env-value")
+			return line, append(kinds, "env-value")
+		}
+	}
+
+	line = replaceFunc(secretAssignment, line, func(m []string) (string, bool) {
+		quoted := m[2] != "" && m[2] == m[4]
+		if isPlaceholderValue(m[3]) || (!quoted && !looksLiteral(m[3])) {
+			return "", false
+		}
+		kinds = append(kinds, "assignment")
+		return m[1] + m[2] + Placeholder("assignment") + m[4], true
+	})
+
+	line = replaceFunc(candidate, line, func(m []string) (string, bool) {
+		if !highEntropy(m[0]) {
+			return "", false
+		}
+		kinds = append(kinds, "high-entropy")
+		return Placeholder("high-entropy"), true
+	})
+
+	return line, kinds
+}
+
+// replaceFunc is regexp.ReplaceAllStringFunc with access to submatches;
+// fn returns false to leave a match alone.
+func replaceFunc(re *regexp.Regexp, s string, fn func([]string) (string, bool)) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range re.FindAllStringSubmatchIndex(s, -1) {
+		groups := make([]string, len(loc)/2)
+		for g := range groups {
+			if loc[2*g] >= 0 {
+				groups[g] = s[loc[2*g]:loc[2*g+1]]
+			}
+		}
+		repl, ok := fn(groups)
+		if !ok {
+			continue
+		}
+		b.WriteString(s[last:loc[0]])
+		b.WriteString(repl)
+		last = loc[1]
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// isPlaceholderValue reports whether an assigned value is obviously not a
+// real secret: empty, already redacted, a variable reference or a
+// documentation placeholder.
+func isPlaceholderValue(v string) bool {
+	v = strings.Trim(strings.TrimSpace(v), `"'`)
+	if v == "" || strings.Contains(v, "<redacted:") {
+		return true
+	}
+	if strings.HasPrefix(v, "$") || strings.HasPrefix(v, "{{") || strings.HasPrefix(v, "os.") || strings.HasPrefix(v, "process.env") {
+		return true
+	}
+	lower := strings.ToLower(v)
+	for _, word := range []string{"your", "example", "changeme", "xxxx", "...", "<", "placeholder", "dummy"} {
+		if strings.Contains(lower, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// looksLiteral tells an unquoted secret such as password: hunter2x apart
+// from code such as token = getToken() or size: maxSize.
+func looksLiteral(v string) bool {
+	var letter, digit bool
+	for _, r := range v {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			letter = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case strings.ContainsRune("+/=_-!@#%^&*", r):
+		default:
+			return false
+		}
+	}
+	return letter && digit
+}
+
+// isEnvFile matches .env and .env.local style files, but not the
+// .env.example templates that are meant to be committed.
+func isEnvFile(p string) bool {
+	base := path.Base(p)
+	if base != ".env" && !strings.HasPrefix(base, ".env.") {
+		return false
+	}
+	for _, suffix := range []string{".example", ".sample", ".template", ".dist"} {
+		if strings.HasSuffix(base, suffix) {
+			return false
+		}
+	}
+	return true
+}
+
+// highEntropy reports whether s looks like an encoded key rather than an
+// identifier or a path: it mixes upper case, lower case and digits, switches
+// between them far more often than CamelCase words do, and has high Shannon
+// entropy.
+func highEntropy(s string) bool {
+	var upper, lower, digit bool
+	switches, prev := 0, 0
+	for _, r := range s {
+		class := 0
+		switch {
+		case r >= 'A' && r <= 'Z':
+			upper, class = true, 1
+		case r >= 'a' && r <= 'z':
+			lower, class = true, 2
+		case r >= '0' && r <= '9':
+			digit, class = true, 3
+		}
+		if prev != 0 && class != prev {
+			switches++
+		}
+		prev = class
+	}
+	if !upper || !lower || !digit {
+		return false
+	}
+	return float64(switches) >= switchRatio*float64(len(s)) && entropy(s) >= entropyThreshold
+}
+
+func entropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+	var h float64
+	n := float64(len(s))
+	for _, c := range counts {
+		p := float64(c) / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
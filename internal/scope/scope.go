@@ -0,0 +1,207 @@
+// Package scope infers a conventional-commit scope from the changed paths.
+package scope
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+)
+
+// CodeownersFiles are the places GitHub and GitLab look for CODEOWNERS.
+var CodeownersFiles = []string{"CODEOWNERS", ".github/CODEOWNERS", ".gitlab/CODEOWNERS", "docs/CODEOWNERS"}
+
+// genericDirs are leading directories that say nothing about the area of a
+// change, so "internal/cache" gives "cache".
+var genericDirs = map[string]bool{
+	"internal": true, "pkg": true, "cmd": true, "src": true, "lib": true,
+	"app": true, "apps": true, "packages": true, "libs": true, "modules": true,
+	"services": true,
+}
+
+// Options are the explicit sources of scopes, tried before Go package
+// names and directories.
+type Options struct {
+	// Rules maps globs in .gitignore syntax to scope names, as in the
+	// scopes section of the config. Longer globs are tried first.
+	Rules map[string]string
+	// Owners are the sectioned rules of a CODEOWNERS file.
+	Owners []OwnerRule
+}
+
+// OwnerRule is a CODEOWNERS pattern that appears under a "[Section]"
+// heading.
+type OwnerRule struct {
+	Pattern string
+	Section string
+}
+
+// Infer returns the scope shared by every changed file, or "" when the
+// changes span several areas. Each file's scope comes from the first of:
+// a matching rule, the section of the last matching CODEOWNERS entry, its Go
+// package name; files with none of these share the scope of their common
+// directory.
+func Infer(changes *diff.Diff, opts Options) string {
+	if changes.Empty() {
+		return ""
+	}
+
+	packages := map[string]string{}
+	for _, c := range changes.API {
+		if c.Package != "" && c.Package != "main" {
+			packages[path.Dir(c.Path)] = c.Package
+		}
+	}
+
+	rules := sortedRules(opts.Rules)
+	owners := make([]rule, len(opts.Owners))
+	for i, o := range opts.Owners {
+		owners[i] = rule{filter: diff.NewFilter([]string{o.Pattern}), glob: o.Pattern, name: o.Section}
+	}
+
+	var scopes []string
+	var rest []string
+	for _, f := range changes.Files {
+		if s := explicit(f.Path, rules, owners); s != "" {
+			scopes = append(scopes, s)
+		} else if pkg := packages[path.Dir(f.Path)]; pkg != "" {
+			scopes = append(scopes, pkg)
+		} else {
+			rest = append(rest, f.Path)
+		}
+	}
+	if len(rest) > 0 {
+		scopes = append(scopes, dirScope(commonDir(rest)))
+	}
+
+	for _, s := range scopes[1:] {
+		if s != scopes[0] {
+			return ""
+		}
+	}
+	return scopes[0]
+}
+
+type rule struct {
+	filter *diff.Filter
+	glob   string
+	name   string
+}
+
+// sortedRules orders rules from the longest glob to the shortest, so that
+// "internal/cache/lru/" wins over "internal/cache/".
+func sortedRules(m map[string]string) []rule {
+	rules := make([]rule, 0, len(m))
+	for glob, name := range m {
+		rules = append(rules, rule{filter: diff.NewFilter([]string{glob}), glob: glob, name: name})
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if len(rules[i].glob) != len(rules[j].glob) {
+			return len(rules[i].glob) > len(rules[j].glob)
+		}
+		return rules[i].glob < rules[j].glob
+	})
+	return rules
+}
+
+func explicit(p string, rules, owners []rule) string {
+	for _, r := range rules {
+		if r.filter.Excludes(p) {
+			return r.name
+		}
+	}
+
+	// As in CODEOWNERS itself, the last matching pattern wins
+	for i := len(owners) - 1; i >= 0; i-- {
+		if owners[i].filter.Excludes(p) {
+			return owners[i].name
+		}
+	}
+	return ""
+}
+
+// commonDir returns the deepest directory containing every path, or "."
+// when they only share the repository root.
+func commonDir(paths []string) string {
+	common := strings.Split(path.Dir(paths[0]), "/")
+	for _, p := range paths[1:] {
+		parts := strings.Split(path.Dir(p), "/")
+		n := 0
+		for n < len(common) && n < len(parts) && common[n] == parts[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	if len(common) == 0 {
+		return "."
+	}
+	return strings.Join(common, "/")
+}
+
+// dirScope names a directory by its first component that is not a generic
+// container such as internal/ or pkg/. Hidden directories such as .github
+// have no scope.
+func dirScope(dir string) string {
+	if dir == "." || dir == "" {
+		return ""
+	}
+	for _, part := range strings.Split(dir, "/") {
+		switch {
+		case strings.HasPrefix(part, "."):
+			return ""
+		case !genericDirs[part]:
+			return part
+		}
+	}
+	return ""
+}
+
+// ParseCodeowners reads the rules that sit under a GitLab-style
+// "[Section]" heading; rules before the first heading have no section and
+// are skipped. Section names are lower-cased with spaces turned into
+// hyphens.
+func ParseCodeowners(r io.Reader) []OwnerRule {
+	var rules []OwnerRule
+	section := ""
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// "[Name]", "^[Optional]" and "[Name][2] @default-owner"
+		if heading := strings.TrimPrefix(line, "^"); strings.HasPrefix(heading, "[") {
+			if end := strings.Index(heading, "]"); end > 0 {
+				section = strings.ToLower(strings.Join(strings.Fields(heading[1:end]), "-"))
+				continue
+			}
+		}
+
+		if section == "" {
+			continue
+		}
+		pattern := strings.Fields(line)[0]
+		rules = append(rules, OwnerRule{Pattern: pattern, Section: section})
+	}
+	return rules
+}
+
+// LoadCodeowners reads the first CODEOWNERS file found in CodeownersFiles,
+// relative to the repository root. No file means no rules.
+func LoadCodeowners() []OwnerRule {
+	for _, name := range CodeownersFiles {
+		f, err := os.Open(name)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+		return ParseCodeowners(f)
+	}
+	return nil
+}
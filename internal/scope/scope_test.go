@@ -0,0 +1,92 @@
+package scope
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+)
+
+func TestInferFromDirectories(t *testing.T) {
+	cases := []struct {
+		files  []string
+		expect string
+	}{
+		{[]string{"internal/cache/cache.go"}, "cache"},
+		{[]string{"internal/cache/cache.go", "internal/cache/lru/lru.go"}, "cache"},
+		{[]string{"internal/cache/cache.go", "internal/config/config.go"}, ""},
+		{[]string{"internal/cache/cache.go", "README.md"}, ""},
+		{[]string{"main.go"}, ""},
+		{[]string{".github/workflows/ci.yml"}, ""},
+		{[]string{"docs/usage.md", "docs/api/index.md"}, "docs"},
+	}
+
+	for _, c := range cases {
+		if got := Infer(diff.FromPatch(c.files, ""), Options{}); got != c.expect {
+			t.Errorf("Infer(%v) = %q, want %q", c.files, got, c.expect)
+		}
+	}
+}
+
+func TestInferFromRules(t *testing.T) {
+	opts := Options{Rules: map[string]string{
+		"internal/cache/":     "cache",
+		"internal/cache/lru/": "lru",
+		"*.md":                "docs",
+	}}
+
+	cases := []struct {
+		files  []string
+		expect string
+	}{
+		{[]string{"internal/cache/lru/lru.go"}, "lru"},
+		{[]string{"internal/cache/cache.go", "internal/cache/lru/lru.go"}, ""},
+		{[]string{"README.md", "docs/usage.md"}, "docs"},
+		{[]string{"internal/config/config.go"}, "config"},
+	}
+
+	for _, c := range cases {
+		if got := Infer(diff.FromPatch(c.files, ""), opts); got != c.expect {
+			t.Errorf("Infer(%v) = %q, want %q", c.files, got, c.expect)
+		}
+	}
+}
+
+func TestInferFromCodeowners(t *testing.T) {
+	owners := ParseCodeowners(strings.NewReader(`# Global owners have no section
+* @core
+
+[Cache Layer] @cache-team
+internal/cache/ @alice
+
+^[Docs]
+*.md
+/internal/cache/README.md @bob
+`))
+
+	if len(owners) != 3 || owners[0].Section != "cache-layer" || owners[1].Section != "docs" {
+		t.Fatalf("unexpected rules %+v", owners)
+	}
+
+	opts := Options{Owners: owners}
+	if got := Infer(diff.FromPatch([]string{"internal/cache/cache.go"}, ""), opts); got != "cache-layer" {
+		t.Errorf("expected the section as scope, got %q", got)
+	}
+	if got := Infer(diff.FromPatch([]string{"internal/cache/README.md"}, ""), opts); got != "docs" {
+		t.Errorf("expected the last matching section to win, got %q", got)
+	}
+}
+
+func TestInferFromGoPackage(t *testing.T) {
+	changes := diff.FromPatch([]string{"server/http/handler.go", "server/http/routes.go"}, "")
+	changes.API = []diff.APIChange{{Kind: diff.APIAdded, Decl: "func", Package: "httpapi", Name: "Serve", Path: "server/http/routes.go"}}
+
+	if got := Infer(changes, Options{}); got != "httpapi" {
+		t.Errorf("expected the package name as scope, got %q", got)
+	}
+
+	changes.API[0].Package = "main"
+	if got := Infer(changes, Options{}); got != "server" {
+		t.Errorf("package main should fall back to the directory, got %q", got)
+	}
+}
@@ -0,0 +1,186 @@
+// Package split groups staged changes into several logical commits and
+// creates them one at a time.
+package split
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+	"github.com/joaquinalmora/commitgen/internal/scope"
+)
+
+// Commit is one proposed commit: a group of changed files and the message
+// to record them with.
+type Commit struct {
+	Files    []string
+	Message  string
+	Provider string
+}
+
+// Options control how changes are grouped.
+type Options struct {
+	// Scopes are the explicit scope sources used to tell areas apart.
+	Scopes scope.Options
+	// Packages are the directories of monorepo packages; files below one
+	// are committed together.
+	Packages []string
+}
+
+const (
+	groupDocs  = "docs"
+	groupOther = ""
+)
+
+// Plan groups changes into commits, leaving their messages empty. Files
+// below the same monorepo package go together, then documentation, then
+// files with the same scope as scope.Infer gives for each file alone.
+// Files with no scope of their own, such as those at the root, share a
+// commit. Commits follow the order in which their first file appears in
+// the diff, with documentation and the shared commit last.
+func Plan(changes *diff.Diff, opts Options) []Commit {
+	var keys []string
+	files := map[string][]string{}
+	for _, f := range changes.Files {
+		key := groupOf(changes, f.Path, opts)
+		if _, ok := files[key]; !ok {
+			keys = append(keys, key)
+		}
+		files[key] = append(files[key], f.Path)
+	}
+
+	var commits []Commit
+	for _, last := range []bool{false, true} {
+		for _, key := range keys {
+			if (key == groupDocs || key == groupOther) == last {
+				commits = append(commits, Commit{Files: files[key]})
+			}
+		}
+	}
+	return commits
+}
+
+// groupOf returns the key of the group p belongs to.
+func groupOf(changes *diff.Diff, p string, opts Options) string {
+	pkg := ""
+	for _, dir := range opts.Packages {
+		if strings.HasPrefix(p, dir+"/") && len(dir) > len(pkg) {
+			pkg = dir
+		}
+	}
+	switch {
+	case pkg != "":
+		return "package:" + pkg
+	case isDoc(p):
+		return groupDocs
+	}
+	if s := scope.Infer(changes.Select([]string{p}), opts.Scopes); s != "" {
+		return "scope:" + s
+	}
+	return groupOther
+}
+
+// isDoc reports whether p is documentation rather than code.
+func isDoc(p string) bool {
+	switch strings.ToLower(path.Ext(p)) {
+	case ".md", ".rst", ".adoc":
+		return true
+	}
+	top, _, _ := strings.Cut(p, "/")
+	return top == "docs" || top == "doc"
+}
+
+// Apply creates commits from the staged changes in order. The index is
+// reset to HEAD, and each commit's files are restaged with git apply
+// --cached and committed with its message; the working tree is never
+// touched. flags are passed on to git commit. report is called after each
+// commit with its abbreviated hash.
+//
+// On any failure the index is put back as it was, so whatever has not been
+// committed yet is still staged, and the number of commits created so far
+// is returned with the error.
+func Apply(changes *diff.Diff, commits []Commit, flags []string, report func(Commit, string)) (int, error) {
+	tree, err := git("", "write-tree")
+	if err != nil {
+		return 0, err
+	}
+	tree = strings.TrimSpace(tree)
+
+	patches := make([]string, len(commits))
+	for i, c := range commits {
+		args := []string{"diff", "--cached", "--binary", "--no-color", "--no-ext-diff", "--src-prefix=a/", "--dst-prefix=b/", "--"}
+		patches[i], err = git("", append(args, pathspec(changes, c.Files)...)...)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	base := "HEAD"
+	if _, err := git("", "rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		base = "--empty"
+	}
+	if _, err := git("", "read-tree", base); err != nil {
+		return 0, restore(tree, err)
+	}
+
+	for i, c := range commits {
+		if patches[i] != "" {
+			if _, err := git(patches[i], "apply", "--cached", "-"); err != nil {
+				return i, restore(tree, err)
+			}
+		}
+		args := append([]string{"commit", "--quiet", "--file=-"}, flags...)
+		if _, err := git(c.Message, args...); err != nil {
+			return i, restore(tree, err)
+		}
+		hash, _ := git("", "rev-parse", "--short", "HEAD")
+		if report != nil {
+			report(c, strings.TrimSpace(hash))
+		}
+	}
+	return len(commits), nil
+}
+
+// pathspec lists files with the old paths of renamed or copied ones, so
+// that git diff still sees the rename.
+func pathspec(changes *diff.Diff, files []string) []string {
+	keep := make(map[string]bool, len(files))
+	for _, f := range files {
+		keep[f] = true
+	}
+	spec := append([]string(nil), files...)
+	for _, f := range changes.Files {
+		if keep[f.Path] && f.OldPath != "" && f.OldPath != f.Path {
+			spec = append(spec, f.OldPath)
+		}
+	}
+	return spec
+}
+
+// restore puts the index back to tree after err.
+func restore(tree string, err error) error {
+	if _, rerr := git("", "read-tree", tree); rerr != nil {
+		return fmt.Errorf("%w; restoring the index also failed: %v", err, rerr)
+	}
+	return err
+}
+
+// git runs a git command with stdin as its input, reporting git's own
+// message when it fails.
+func git(stdin string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,155 @@
+package split
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+	"github.com/joaquinalmora/commitgen/internal/scope"
+)
+
+func TestPlan(t *testing.T) {
+	changes := diff.FromPatch([]string{
+		"README.md",
+		"internal/cache/cache.go",
+		"go.mod",
+		"services/api/handler.go",
+		"internal/cache/cache_test.go",
+		"docs/usage.md",
+		"internal/config/config.go",
+		"services/api/README.md",
+		"internal/lru/lru.go",
+	}, "")
+
+	got := Plan(changes, Options{
+		Scopes:   scope.Options{Rules: map[string]string{"internal/lru/": "cache"}},
+		Packages: []string{"services/api"},
+	})
+
+	want := [][]string{
+		{"internal/cache/cache.go", "internal/cache/cache_test.go", "internal/lru/lru.go"},
+		{"services/api/handler.go", "services/api/README.md"},
+		{"internal/config/config.go"},
+		{"README.md", "docs/usage.md"},
+		{"go.mod"},
+	}
+	var files [][]string
+	for _, c := range got {
+		files = append(files, c.Files)
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("Plan() grouped\n%v\nwant\n%v", files, want)
+	}
+}
+
+func run(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func write(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newRepo creates a repository with one commit and changes staged in two
+// areas, and runs the test from it.
+func newRepo(t *testing.T) (string, *diff.Diff) {
+	t.Helper()
+	repo := t.TempDir()
+	run(t, repo, "init", "-q")
+	run(t, repo, "config", "user.email", "split@example.com")
+	run(t, repo, "config", "user.name", "split")
+	run(t, repo, "config", "commit.gpgsign", "false")
+	write(t, repo, "cache/cache.go", "package cache\n")
+	write(t, repo, "old.txt", "notes\n")
+	run(t, repo, "add", ".")
+	run(t, repo, "commit", "-q", "-m", "init")
+
+	write(t, repo, "cache/cache.go", "package cache\n\nfunc Get() {}\n")
+	write(t, repo, "README.md", "# demo\n")
+	run(t, repo, "mv", "old.txt", "new.txt")
+	run(t, repo, "add", ".")
+	write(t, repo, "README.md", "# demo\nunstaged\n")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(repo); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	changes, err := diff.Staged(1<<20, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo, changes
+}
+
+func TestApply(t *testing.T) {
+	repo, changes := newRepo(t)
+	commits := []Commit{
+		{Files: []string{"cache/cache.go"}, Message: "feat(cache): add Get"},
+		{Files: []string{"README.md", "new.txt"}, Message: "docs: add README"},
+	}
+
+	var hashes []string
+	n, err := Apply(changes, commits, nil, func(c Commit, hash string) { hashes = append(hashes, hash) })
+	if err != nil || n != 2 || len(hashes) != 2 {
+		t.Fatalf("Apply() = %d, %v with hashes %v", n, err, hashes)
+	}
+
+	if log := run(t, repo, "log", "--format=%s", "-3"); log != "docs: add README\nfeat(cache): add Get\ninit" {
+		t.Errorf("unexpected history:\n%s", log)
+	}
+	if files := run(t, repo, "show", "--name-status", "--format=", "HEAD"); !strings.Contains(files, "R100\told.txt\tnew.txt") {
+		t.Errorf("expected the rename to be kept, got:\n%s", files)
+	}
+	if status := run(t, repo, "status", "--porcelain"); status != "M README.md" {
+		t.Errorf("expected only the unstaged change to remain, got %q", status)
+	}
+}
+
+func TestApplyRestoresIndexOnFailure(t *testing.T) {
+	repo, changes := newRepo(t)
+	tree := run(t, repo, "write-tree")
+
+	// The second commit fails in its pre-commit hook
+	write(t, repo, ".git/hooks/pre-commit", "#!/bin/sh\n[ -f .git/seen ] && exit 1\ntouch .git/seen\n")
+	if err := os.Chmod(filepath.Join(repo, ".git/hooks/pre-commit"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	commits := []Commit{
+		{Files: []string{"cache/cache.go"}, Message: "feat(cache): add Get"},
+		{Files: []string{"README.md", "new.txt"}, Message: "docs: add README"},
+	}
+	n, err := Apply(changes, commits, nil, nil)
+	if err == nil || n != 1 {
+		t.Fatalf("expected a failure after one commit, got %d, %v", n, err)
+	}
+	if got := run(t, repo, "write-tree"); got != tree {
+		t.Errorf("index not restored: %s, want %s", got, tree)
+	}
+	if staged := run(t, repo, "diff", "--cached", "--name-only"); staged != "README.md\nnew.txt" {
+		t.Errorf("expected the second commit's files to stay staged, got %q", staged)
+	}
+}
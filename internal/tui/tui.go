@@ -0,0 +1,467 @@
+// Package tui is the review screen behind suggest -i and commit -i. On a
+// terminal it takes single keys and redraws itself; anywhere else it falls
+// back to plain prompts, one command per line. Input and output are plain
+// streams so that both modes can be driven from tests.
+package tui
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+	"github.com/joaquinalmora/commitgen/internal/message"
+)
+
+// Request holds the generation settings the screen can change.
+type Request struct {
+	Provider string
+	// Model is empty for the provider's default
+	Model string
+	Body  bool
+}
+
+// Generator writes a new message for the changes under review, returning
+// it with the name of the backend that wrote it.
+type Generator func(ctx context.Context, req Request) (msg, provider string, err error)
+
+// Screen is one review of a proposed commit message.
+type Screen struct {
+	Files    []diff.File
+	Message  string
+	Provider string
+	Request  Request
+
+	// Providers are the backends the provider key cycles through
+	Providers []string
+	// Types and Scopes are what the type and scope keys cycle through
+	Types  []string
+	Scopes []string
+
+	Generate Generator
+	// Editor, when set, edits the whole message, body included, and
+	// returns the saved text
+	Editor func(text string) (string, error)
+
+	In  io.Reader
+	Out io.Writer
+	// Keys reads single key presses and redraws the screen after each, as
+	// on a terminal in cbreak mode. Otherwise each command is a line.
+	Keys bool
+
+	status string
+	reader *bufio.Reader
+	// pending is a key read started while generating that has not been
+	// consumed yet
+	pending chan keyRead
+}
+
+type keyRead struct {
+	b   byte
+	err error
+}
+
+const help = "[enter] accept  [r] regenerate  [e] edit subject  [v] edit in editor  [p] provider  [m] model  [b] body  [t] type  [s] scope  [q] quit"
+
+// Run shows the screen until the message is accepted, returning true, or
+// the review is cancelled. Message, Provider and Request hold the final
+// state either way.
+func (s *Screen) Run(ctx context.Context) (bool, error) {
+	s.reader = bufio.NewReader(s.In)
+	if s.Keys {
+		// The alternate screen leaves the user's scrollback untouched
+		fmt.Fprint(s.Out, "\033[?1049h")
+		defer fmt.Fprint(s.Out, "\033[?1049l")
+	}
+
+	for {
+		s.draw()
+		key, err := s.readKey()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		s.status = ""
+
+		switch key {
+		case '\r', '\n', 'a', 'y':
+			return true, nil
+		case 'q', 3: // 3 is Ctrl-C with signals turned off
+			return false, nil
+		case 'r':
+			s.regenerate(ctx)
+		case 'e':
+			s.edit()
+		case 'v':
+			s.editAll()
+		case 'p':
+			if len(s.Providers) == 0 {
+				s.status = "no other providers are configured"
+				break
+			}
+			s.Request.Provider = next(s.Providers, s.Request.Provider)
+			s.Request.Model = ""
+			s.regenerate(ctx)
+		case 'm':
+			if model, ok := s.readLine("Model (empty for the default): ", s.Request.Model); ok {
+				s.Request.Model = strings.TrimSpace(model)
+				s.regenerate(ctx)
+			}
+		case 'b':
+			s.Request.Body = !s.Request.Body
+			s.regenerate(ctx)
+		case 't':
+			s.cycleType()
+		case 's':
+			s.cycleScope()
+		default:
+			s.status = fmt.Sprintf("unknown key %q", key)
+		}
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+	}
+}
+
+func (s *Screen) draw() {
+	if s.Keys {
+		fmt.Fprint(s.Out, "\033[H\033[2J")
+	}
+	w := s.Out
+
+	added, removed := 0, 0
+	for _, f := range s.Files {
+		added += f.Added
+		removed += f.Removed
+	}
+	fmt.Fprintf(w, "Changes: %d files, +%d -%d\n", len(s.Files), added, removed)
+	for _, f := range s.Files {
+		fmt.Fprintf(w, "  %s\n", f.Describe())
+	}
+
+	fmt.Fprintf(w, "\nMessage from %s", s.Provider)
+	if s.Request.Model != "" && s.Provider == s.Request.Provider {
+		fmt.Fprintf(w, " (%s)", s.Request.Model)
+	}
+	if s.Request.Body {
+		fmt.Fprint(w, ", with body")
+	}
+	fmt.Fprintln(w, ":")
+	for _, line := range strings.Split(s.Message, "\n") {
+		fmt.Fprintf(w, "  %s\n", line)
+	}
+
+	if s.status != "" {
+		fmt.Fprintf(w, "\n%s\n", s.status)
+	}
+	fmt.Fprintf(w, "\n%s\n", help)
+	if !s.Keys {
+		fmt.Fprint(w, "> ")
+	}
+}
+
+func (s *Screen) regenerate(ctx context.Context) {
+	if s.Generate == nil {
+		return
+	}
+	name := s.Request.Provider
+	if name == "" {
+		name = "the default provider"
+	}
+	if !s.Keys {
+		// Ctrl-C is still a signal here and cancels ctx
+		fmt.Fprintf(s.Out, "Generating with %s...\n", name)
+		s.finishGenerate(s.Generate(ctx, s.Request))
+		return
+	}
+	fmt.Fprintf(s.Out, "Generating with %s... [q] cancel\n", name)
+
+	// Signals are off in cbreak mode, so read a key meanwhile: Ctrl-C or q
+	// cancels the request
+	genCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type reply struct {
+		msg, provider string
+		err           error
+	}
+	done := make(chan reply, 1)
+	go func() {
+		msg, provider, err := s.Generate(genCtx, s.Request)
+		done <- reply{msg, provider, err}
+	}()
+
+	for {
+		if s.pending == nil {
+			s.pending = make(chan keyRead, 1)
+			go func(ch chan<- keyRead) {
+				b, err := s.reader.ReadByte()
+				ch <- keyRead{b, err}
+			}(s.pending)
+		}
+
+		select {
+		case r := <-done:
+			s.finishGenerate(r.msg, r.provider, r.err)
+			return
+		case k := <-s.pending:
+			if k.err == nil && k.b != 3 && k.b != 'q' {
+				// Any other key is kept for after the message arrives
+				s.pending = make(chan keyRead, 1)
+				s.pending <- k
+				r := <-done
+				s.finishGenerate(r.msg, r.provider, r.err)
+				return
+			}
+			s.pending = nil
+			cancel()
+			r := <-done
+			if r.err != nil && genCtx.Err() != nil {
+				s.status = "generation cancelled"
+				return
+			}
+			s.finishGenerate(r.msg, r.provider, r.err)
+			return
+		}
+	}
+}
+
+func (s *Screen) finishGenerate(msg, provider string, err error) {
+	if err != nil {
+		s.status = "generation failed: " + firstLine(err.Error())
+		return
+	}
+	s.Message, s.Provider = strings.TrimSpace(msg), provider
+}
+
+// edit lets the user rewrite the header line, keeping any body.
+func (s *Screen) edit() {
+	header, rest, _ := strings.Cut(s.Message, "\n")
+	edited, ok := s.readLine("Subject: ", header)
+	if !ok || strings.TrimSpace(edited) == "" {
+		return
+	}
+	s.Message = strings.TrimSpace(edited)
+	if rest != "" {
+		s.Message += "\n" + rest
+	}
+	s.Provider = "edited"
+}
+
+// editAll opens the whole message in the Editor, leaving the alternate
+// screen for as long as it runs.
+func (s *Screen) editAll() {
+	if s.Editor == nil {
+		s.status = "no editor available"
+		return
+	}
+	if s.Keys {
+		fmt.Fprint(s.Out, "\033[?1049l")
+		defer fmt.Fprint(s.Out, "\033[?1049h")
+	}
+
+	edited, err := s.Editor(s.Message)
+	switch {
+	case err != nil:
+		s.status = "editing failed: " + firstLine(err.Error())
+	case strings.TrimSpace(edited) == "":
+		s.status = "the edited message was empty; keeping the previous one"
+	default:
+		s.Message = strings.TrimSpace(edited)
+		s.Provider = "edited"
+	}
+}
+
+// cycleType moves the header to the next allowed type, turning a plain
+// header into a conventional one.
+func (s *Screen) cycleType() {
+	if len(s.Types) == 0 {
+		return
+	}
+	s.setHeader(func(m *message.Message) {
+		m.Type = next(s.Types, m.Type)
+	})
+}
+
+// cycleScope moves the header to the next scope, then to no scope at all.
+func (s *Screen) cycleScope() {
+	s.setHeader(func(m *message.Message) {
+		m.Scope = next(append([]string{""}, s.Scopes...), m.Scope)
+	})
+}
+
+func (s *Screen) setHeader(change func(*message.Message)) {
+	header, rest, _ := strings.Cut(s.Message, "\n")
+	m, ok := message.ParseHeader(header)
+	if !ok {
+		m = message.Message{Subject: header}
+		if len(s.Types) > 0 {
+			m.Type = s.Types[0]
+		}
+	}
+	change(&m)
+	if m.Type == "" {
+		return
+	}
+	s.Message = m.Header()
+	if rest != "" {
+		s.Message += "\n" + rest
+	}
+}
+
+// readKey returns the next command: a key press, or the first character
+// of a line in plain mode, where an empty line accepts.
+func (s *Screen) readKey() (rune, error) {
+	if !s.Keys {
+		line, err := s.reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if err != nil {
+				return 0, err
+			}
+			return '\n', nil
+		}
+		r, _ := utf8.DecodeRuneInString(strings.ToLower(line))
+		return r, nil
+	}
+
+	for {
+		b, err := s.readByte()
+		if err != nil {
+			return 0, err
+		}
+		if b == 27 {
+			s.skipEscape()
+			continue
+		}
+		return rune(b), nil
+	}
+}
+
+// readByte returns the next input byte, starting with one read while
+// generating if there is one.
+func (s *Screen) readByte() (byte, error) {
+	if s.pending != nil {
+		k := <-s.pending
+		s.pending = nil
+		return k.b, k.err
+	}
+	return s.reader.ReadByte()
+}
+
+// skipEscape consumes the rest of an escape sequence such as an arrow key,
+// "\033[A", after its escape byte, reporting whether there was one. A
+// terminal sends the whole sequence at once, so a lone escape press has
+// nothing buffered after it.
+func (s *Screen) skipEscape() bool {
+	if s.reader.Buffered() == 0 {
+		return false
+	}
+	next, err := s.reader.Peek(1)
+	if err != nil || (next[0] != '[' && next[0] != 'O') {
+		return false
+	}
+	_, _ = s.reader.ReadByte()
+	for s.reader.Buffered() > 0 {
+		// Parameters and intermediates run up to a final byte in @ to ~
+		if b, err := s.reader.ReadByte(); err != nil || (b >= '@' && b <= '~') {
+			break
+		}
+	}
+	return true
+}
+
+// readLine prompts for a line, starting from initial. In plain mode an
+// empty answer keeps initial. ok is false when the edit was abandoned with
+// Escape or Ctrl-C, or the input ended.
+func (s *Screen) readLine(prompt, initial string) (string, bool) {
+	if !s.Keys {
+		fmt.Fprintf(s.Out, "%s[%s] ", prompt, initial)
+		line, err := s.reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			return initial, err == nil
+		}
+		return line, true
+	}
+
+	// Cbreak mode has no echo or line editing, so do both here. Input is
+	// kept as bytes, as multi-byte UTF-8 characters arrive one byte at a
+	// time.
+	text := []byte(initial)
+	fmt.Fprintf(s.Out, "\n%s%s", prompt, initial)
+	for {
+		b, err := s.readByte()
+		if err != nil {
+			return initial, false
+		}
+		switch {
+		case b == '\r' || b == '\n':
+			return string(text), true
+		case b == 27:
+			// Arrow keys and the like are ignored; Escape itself cancels
+			if !s.skipEscape() {
+				return initial, false
+			}
+		case b == 3:
+			return initial, false
+		case b == 127 || b == 8:
+			if len(text) > 0 {
+				_, size := utf8.DecodeLastRune(text)
+				text = text[:len(text)-size]
+				fmt.Fprint(s.Out, "\b \b")
+			}
+		case b == 21: // Ctrl-U clears the line
+			fmt.Fprint(s.Out, strings.Repeat("\b \b", utf8.RuneCount(text)))
+			text = text[:0]
+		case b >= 32:
+			text = append(text, b)
+			_, _ = s.Out.Write([]byte{b})
+		}
+	}
+}
+
+// next returns the item after current in list, wrapping around; an
+// unknown current gives the first item.
+func next(list []string, current string) string {
+	for i, item := range list {
+		if item == current {
+			return list[(i+1)%len(list)]
+		}
+	}
+	return list[0]
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// Cbreak switches the terminal on f to single-key input without echo or
+// signals, so that Ctrl-C reaches the screen as a key, and returns a
+// function that restores the previous settings. It relies on stty, and
+// fails where there is none.
+func Cbreak(f *os.File) (restore func(), err error) {
+	stty := func(args ...string) (string, error) {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = f
+		out, err := cmd.Output()
+		return strings.TrimSpace(string(out)), err
+	}
+
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("-icanon", "-echo", "-isig", "min", "1", "time", "0"); err != nil {
+		return nil, err
+	}
+	return func() { _, _ = stty(saved) }, nil
+}
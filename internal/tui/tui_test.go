@@ -0,0 +1,161 @@
+package tui
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/joaquinalmora/commitgen/internal/diff"
+)
+
+func newScreen(input string, keys bool) (*Screen, *bytes.Buffer, *[]Request) {
+	var out bytes.Buffer
+	var requests []Request
+	s := &Screen{
+		Files:     diff.FromPatch([]string{"internal/cache/cache.go"}, "").Files,
+		Message:   "feat(cache): add Cache.Delete",
+		Provider:  "openai",
+		Request:   Request{Provider: "openai", Model: "gpt-4o-mini"},
+		Providers: []string{"openai", "anthropic", "heuristics"},
+		Types:     []string{"feat", "fix", "refactor"},
+		Scopes:    []string{"cache", "lru"},
+		Generate: func(ctx context.Context, req Request) (string, string, error) {
+			requests = append(requests, req)
+			if req.Provider == "heuristics" {
+				return "", "", fmt.Errorf("no key\ndetails")
+			}
+			msg := "fix(cache): evict on Delete"
+			if req.Body {
+				msg += "\n\nExpired entries were kept."
+			}
+			return msg, req.Provider, nil
+		},
+		In:   strings.NewReader(input),
+		Out:  &out,
+		Keys: keys,
+	}
+	return s, &out, &requests
+}
+
+func TestPlainPrompts(t *testing.T) {
+	// Cycle the type and scope, then edit the subject and accept
+	s, out, _ := newScreen("t\ns\ns\ne\nfix(lru): drop stale entries\n\n", false)
+	ok, err := s.Run(context.Background())
+	if err != nil || !ok {
+		t.Fatalf("Run() = %v, %v", ok, err)
+	}
+	if s.Message != "fix(lru): drop stale entries" || s.Provider != "edited" {
+		t.Errorf("unexpected result %q from %s", s.Message, s.Provider)
+	}
+	for _, want := range []string{"internal/cache/cache.go", "Message from openai (gpt-4o-mini)", "fix(lru): add Cache.Delete", "[enter] accept", "> "} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in the output:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "\033[") {
+		t.Error("plain prompts should not draw with escape sequences")
+	}
+}
+
+func TestPlainPromptsCancelAtEOF(t *testing.T) {
+	s, _, _ := newScreen("t\n", false)
+	if ok, err := s.Run(context.Background()); ok || err != nil {
+		t.Errorf("expected the end of input to cancel, got %v, %v", ok, err)
+	}
+}
+
+func TestKeysRegenerate(t *testing.T) {
+	// Body on, next provider, a failing provider, a custom model, accept
+	s, out, requests := newScreen("bpp"+"m\x7f\x7f\x7f\x7f\x7f\x7f\x7f\x7f\x7f\x7f\x7fo3\r"+"\r", true)
+	ok, err := s.Run(context.Background())
+	if err != nil || !ok {
+		t.Fatalf("Run() = %v, %v", ok, err)
+	}
+
+	want := []Request{
+		{Provider: "openai", Model: "gpt-4o-mini", Body: true},
+		{Provider: "anthropic", Body: true},
+		{Provider: "heuristics", Body: true},
+		{Provider: "heuristics", Model: "o3", Body: true},
+	}
+	if fmt.Sprint(*requests) != fmt.Sprint(want) {
+		t.Errorf("requests %v, want %v", *requests, want)
+	}
+	if s.Message != "fix(cache): evict on Delete\n\nExpired entries were kept." || s.Provider != "anthropic" {
+		t.Errorf("expected the last successful message to stay, got %q from %s", s.Message, s.Provider)
+	}
+	if !strings.Contains(out.String(), "generation failed: no key\n") {
+		t.Errorf("expected the failure on screen:\n%s", out.String())
+	}
+	if !strings.HasPrefix(out.String(), "\033[?1049h") || !strings.HasSuffix(out.String(), "\033[?1049l") {
+		t.Error("expected the alternate screen to be entered and left")
+	}
+}
+
+func TestKeysQuit(t *testing.T) {
+	s, _, _ := newScreen("\x1b[Ae\x1bx\x03", true)
+	ok, err := s.Run(context.Background())
+	if ok || err != nil {
+		t.Errorf("expected Ctrl-C to cancel, got %v, %v", ok, err)
+	}
+	if s.Message != "feat(cache): add Cache.Delete" {
+		t.Errorf("an abandoned edit should keep the message, got %q", s.Message)
+	}
+}
+
+func TestKeysEditNonASCII(t *testing.T) {
+	// Clear the subject, type UTF-8 one byte at a time, erase back over an
+	// "é" and press left and right, which must not turn into commands, then
+	// accept
+	s, _, _ := newScreen("e\x15fix(cache): évite les entrées périmées\x7f\x7f\x7f\x1b[D\x1b[C\r\r", true)
+	s.Message = "fix(cache): evict stale entries"
+	ok, err := s.Run(context.Background())
+	if err != nil || !ok {
+		t.Fatalf("Run() = %v, %v", ok, err)
+	}
+	if s.Message != "fix(cache): évite les entrées périm" {
+		t.Errorf("Message = %q", s.Message)
+	}
+}
+
+func TestKeysCancelGeneration(t *testing.T) {
+	// q while generating cancels the request rather than the review
+	s, out, _ := newScreen("rq\r", true)
+	calls := 0
+	s.Generate = func(ctx context.Context, req Request) (string, string, error) {
+		calls++
+		<-ctx.Done()
+		return "", "", ctx.Err()
+	}
+	ok, err := s.Run(context.Background())
+	if err != nil || !ok {
+		t.Fatalf("Run() = %v, %v", ok, err)
+	}
+	if calls != 1 || s.Message != "feat(cache): add Cache.Delete" {
+		t.Errorf("expected one cancelled request and the message kept, got %d and %q", calls, s.Message)
+	}
+	if !strings.Contains(out.String(), "generation cancelled") {
+		t.Errorf("expected the cancellation on screen:\n%s", out.String())
+	}
+}
+
+func TestEditorEditsBody(t *testing.T) {
+	s, _, _ := newScreen("v\n\n", false)
+	var given string
+	s.Editor = func(text string) (string, error) {
+		given = text
+		return "fix(cache): evict on Delete\n\nExpired entries were kept.\n", nil
+	}
+	ok, err := s.Run(context.Background())
+	if err != nil || !ok {
+		t.Fatalf("Run() = %v, %v", ok, err)
+	}
+	if given != "feat(cache): add Cache.Delete" {
+		t.Errorf("editor got %q", given)
+	}
+	if s.Message != "fix(cache): evict on Delete\n\nExpired entries were kept." || s.Provider != "edited" {
+		t.Errorf("unexpected result %q from %s", s.Message, s.Provider)
+	}
+}